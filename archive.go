@@ -0,0 +1,261 @@
+package xgo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveFile is a struct containing a file to add to an archive.
+type ArchiveFile struct {
+	Mode os.FileMode
+	Name string // Name within the archive
+	Path string // Path on disk
+}
+
+// Archive will create an archive (tar.gz or zip) containing the
+// provided files. Timestamps are set to mtime and ownership is set to
+// root, so that the archive is reproducible.
+func Archive(
+	fn string,
+	format string,
+	mtime time.Time,
+	files ...ArchiveFile,
+) error {
+	var e error
+	var f *os.File
+
+	//nolint:gosec // G304 - The caller chooses the archive location
+	if f, e = os.Create(fn); e != nil {
+		return fmt.Errorf("failed to create %s: %w", fn, e)
+	}
+
+	switch format {
+	case "tar.gz":
+		e = archiveTarGz(f, mtime, files)
+	case "zip":
+		e = archiveZip(f, mtime, files)
+	default:
+		e = fmt.Errorf("unsupported archive format %s", format)
+	}
+
+	if e != nil {
+		_ = f.Close()
+		_ = os.Remove(fn)
+
+		return e
+	}
+
+	if e = f.Close(); e != nil {
+		return fmt.Errorf("failed to close %s: %w", fn, e)
+	}
+
+	return nil
+}
+
+func archiveTar(
+	w io.Writer,
+	mtime time.Time,
+	files []ArchiveFile,
+) error {
+	var e error
+	var f *os.File
+	var fi os.FileInfo
+	var tw *tar.Writer = tar.NewWriter(w)
+
+	for _, file := range files {
+		if f, e = os.Open(filepath.Clean(file.Path)); e != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Path, e)
+		}
+
+		if fi, e = f.Stat(); e != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to stat %s: %w", file.Path, e)
+		}
+
+		e = tw.WriteHeader(
+			&tar.Header{
+				Format:   tar.FormatPAX,
+				Mode:     int64(file.Mode.Perm()),
+				ModTime:  mtime,
+				Name:     file.Name,
+				Size:     fi.Size(),
+				Typeflag: tar.TypeReg,
+			},
+		)
+		if e == nil {
+			_, e = io.Copy(tw, f)
+		}
+
+		_ = f.Close()
+
+		if e != nil {
+			return fmt.Errorf("failed to add %s: %w", file.Path, e)
+		}
+	}
+
+	if e = tw.Close(); e != nil {
+		return fmt.Errorf("failed to finalize tar: %w", e)
+	}
+
+	return nil
+}
+
+func archiveTarGz(
+	w io.Writer,
+	mtime time.Time,
+	files []ArchiveFile,
+) error {
+	var e error
+	var gz *gzip.Writer
+
+	// Header is left empty (no name or mtime) for reproducibility
+	gz, e = gzip.NewWriterLevel(w, gzip.BestCompression)
+	if e != nil {
+		return fmt.Errorf("failed to create gzip writer: %w", e)
+	}
+
+	if e = archiveTar(gz, mtime, files); e != nil {
+		return e
+	}
+
+	if e = gz.Close(); e != nil {
+		return fmt.Errorf("failed to finalize gzip: %w", e)
+	}
+
+	return nil
+}
+
+func archiveZip(
+	w io.Writer,
+	mtime time.Time,
+	files []ArchiveFile,
+) error {
+	var e error
+	var f *os.File
+	var hdr *zip.FileHeader
+	var out io.Writer
+	var zw *zip.Writer = zip.NewWriter(w)
+
+	for _, file := range files {
+		hdr = &zip.FileHeader{
+			Method:   zip.Deflate,
+			Modified: mtime.UTC(),
+			Name:     file.Name,
+		}
+		hdr.SetMode(file.Mode.Perm())
+
+		if out, e = zw.CreateHeader(hdr); e != nil {
+			return fmt.Errorf("failed to add %s: %w", file.Path, e)
+		}
+
+		if f, e = os.Open(filepath.Clean(file.Path)); e != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Path, e)
+		}
+
+		_, e = io.Copy(out, f)
+		_ = f.Close()
+
+		if e != nil {
+			return fmt.Errorf("failed to add %s: %w", file.Path, e)
+		}
+	}
+
+	if e = zw.Close(); e != nil {
+		return fmt.Errorf("failed to finalize zip: %w", e)
+	}
+
+	return nil
+}
+
+// SourceDateEpoch will return the time described by the
+// SOURCE_DATE_EPOCH env var, or the earliest time representable in a
+// zip file (1980-01-01) if it is unset or invalid.
+func SourceDateEpoch() time.Time {
+	var e error
+	var epoch int64
+	var s string = os.Getenv("SOURCE_DATE_EPOCH")
+
+	if epoch, e = strconv.ParseInt(s, 10, 64); e != nil {
+		return time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return time.Unix(epoch, 0).UTC()
+}
+
+// Package will create an archive containing the BuildResult's
+// artifact and any extra files (e.g. README or LICENSE). Windows
+// targets will always use zip, while other targets will use the
+// provided format (tar.gz or zip).
+func (r *BuildResult) Package(
+	format string,
+	mtime time.Time,
+	extras ...string,
+) error {
+	var e error
+	var ext string
+	var files []ArchiveFile
+	var fi os.FileInfo
+	var fn string
+	var name string
+	var suffix string
+
+	if r.Artifact == nil {
+		return fmt.Errorf("no artifact to package for %s", r.Target)
+	}
+
+	if r.Target.OS == "windows" {
+		ext = ".exe"
+		format = "zip"
+	}
+
+	suffix = strings.TrimSuffix(r.Target.Output(""), ext)
+
+	// Use the target-specific name for the archive, but the plain
+	// name inside the archive (e.g. app_linux_amd64.tar.gz/app)
+	name = strings.TrimSuffix(filepath.Base(r.Artifact.Path), ext)
+	if !strings.HasSuffix(name, suffix) {
+		name += suffix
+	}
+
+	fn = filepath.Join(filepath.Dir(r.Artifact.Path), name+"."+format)
+	files = []ArchiveFile{
+		{
+			Mode: 0o755, //nolint:mnd // u=rwx,go=rx
+			Name: strings.TrimSuffix(name, suffix) + ext,
+			Path: r.Artifact.Path,
+		},
+	}
+
+	for _, extra := range extras {
+		if fi, e = os.Stat(extra); e != nil {
+			return fmt.Errorf("failed to stat %s: %w", extra, e)
+		}
+
+		files = append(
+			files,
+			ArchiveFile{
+				Mode: archiveMode(fi.Mode()),
+				Name: filepath.Base(extra),
+				Path: extra,
+			},
+		)
+	}
+
+	if e = Archive(fn, format, mtime, files...); e != nil {
+		return e
+	}
+
+	if r.Archive, e = NewArtifact(fn); e != nil {
+		return e
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func archiveResult(t *testing.T, target xgo.Target) *xgo.BuildResult {
+	t.Helper()
+
+	var a *xgo.Artifact
+	var e error
+	var fn string = filepath.Join(t.TempDir(), target.Output("app"))
+
+	assert.NoError(t, os.WriteFile(fn, []byte("binary"), 0o600))
+
+	a, e = xgo.NewArtifact(fn)
+	assert.NoError(t, e)
+
+	return &xgo.BuildResult{Artifact: a, Target: target}
+}
+
+func TestPackageTarGz(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var f *os.File
+	var gz *gzip.Reader
+	var hdr *tar.Header
+	var mtime time.Time = time.Unix(1700000000, 0).UTC()
+	var r *xgo.BuildResult
+	var sums []string
+	var tr *tar.Reader
+
+	r = archiveResult(t, xgo.Target{OS: "linux", Arch: "amd64"})
+
+	for range 2 {
+		e = r.Package("tar.gz", mtime, "LICENSE.txt")
+		assert.NoError(t, e)
+		assert.Equal(
+			t,
+			filepath.Join(
+				filepath.Dir(r.Artifact.Path),
+				"app_linux_amd64.tar.gz",
+			),
+			r.Archive.Path,
+		)
+
+		sums = append(sums, r.Archive.SHA256)
+	}
+
+	// Reproducible
+	assert.Equal(t, sums[0], sums[1])
+
+	f, e = os.Open(r.Archive.Path)
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gz, e = gzip.NewReader(f)
+	assert.NoError(t, e)
+
+	tr = tar.NewReader(gz)
+
+	hdr, e = tr.Next()
+	assert.NoError(t, e)
+	assert.Equal(t, "app", hdr.Name)
+	assert.Equal(t, int64(0o755), hdr.Mode)
+	assert.Equal(t, 0, hdr.Uid)
+	assert.True(t, mtime.Equal(hdr.ModTime))
+
+	hdr, e = tr.Next()
+	assert.NoError(t, e)
+	assert.Equal(t, "LICENSE.txt", hdr.Name)
+	assert.Equal(t, int64(0o644), hdr.Mode)
+}
+
+func TestPackageZip(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var r *xgo.BuildResult
+	var zr *zip.ReadCloser
+
+	r = archiveResult(t, xgo.Target{OS: "windows", Arch: "amd64"})
+
+	// Windows always uses zip
+	e = r.Package("tar.gz", xgo.SourceDateEpoch(), "README.md")
+	assert.NoError(t, e)
+	assert.Equal(
+		t,
+		"app_windows_amd64.zip",
+		filepath.Base(r.Archive.Path),
+	)
+
+	zr, e = zip.OpenReader(r.Archive.Path)
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = zr.Close()
+	}()
+
+	assert.Len(t, zr.File, 2)
+	assert.Equal(t, "app.exe", zr.File[0].Name)
+	assert.Equal(t, os.FileMode(0o755), zr.File[0].Mode().Perm())
+	assert.Equal(t, "README.md", zr.File[1].Name)
+	assert.Equal(t, os.FileMode(0o644), zr.File[1].Mode().Perm())
+}
@@ -0,0 +1,288 @@
+package xgo
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Artifact is a struct containing metadata for a build artifact.
+type Artifact struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+	Size   int64  `json:"size"`
+}
+
+// BuildResult is a struct containing the results of running a go
+// command for a Target.
+type BuildResult struct {
+	Archive    *Artifact      `json:"archive,omitempty"`
+	Artifact   *Artifact      `json:"artifact,omitempty"`
+	Command    []string       `json:"command"`
+	Duration   time.Duration  `json:"duration_ns"`
+	Error      string         `json:"error,omitempty"`
+	ExitStatus int            `json:"exit_status"`
+	Garble     *GarbleOptions `json:"garble,omitempty"`
+	Inputs     []*BuildResult `json:"inputs,omitempty"`
+	Smoke      *SmokeResult   `json:"smoke,omitempty"`
+	Stdout     string         `json:"-"`
+	Target     Target         `json:"target"`
+	Toolchain  Toolchain      `json:"toolchain"`
+}
+
+// Toolchain is a struct containing the resolved toolchain used for a
+// build.
+type Toolchain struct {
+	CC        string `json:"cc,omitempty"`
+	CGO       bool   `json:"cgo"`
+	Compiler  string `json:"compiler"`
+	CXX       string `json:"cxx,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+}
+
+// NewArtifact will return an Artifact describing the provided file.
+func NewArtifact(fn string) (*Artifact, error) {
+	var a *Artifact = &Artifact{Path: fn}
+	var e error
+	var f *os.File
+	var h256 hash.Hash = sha256.New()
+	var h512 hash.Hash = sha512.New()
+
+	if f, e = os.Open(filepath.Clean(fn)); e != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", fn, e)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	a.Size, e = io.Copy(io.MultiWriter(h256, h512), f)
+	if e != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fn, e)
+	}
+
+	a.SHA256 = hex.EncodeToString(h256.Sum(nil))
+	a.SHA512 = hex.EncodeToString(h512.Sum(nil))
+
+	return a, nil
+}
+
+// SetOutput will return a copy of the provided go command args with
+// any existing output flag replaced by "-o out".
+func SetOutput(args []string, out string) []string {
+	var f GoFlag
+	var n int
+	var tmp []string
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	tmp = []string{args[0], "-o", out}
+
+	for i := 1; i < len(args); i++ {
+		// Flags stop at "--" or the first package
+		if (args[i] == "-") || (args[i] == "--") ||
+			!strings.HasPrefix(args[i], "-") {
+			return append(tmp, args[i:]...)
+		}
+
+		if f, n = parseGoFlag(args[i], args[i+1:]); f.Name != "o" {
+			tmp = append(tmp, args[i:i+n]...)
+		}
+
+		i += n - 1
+	}
+
+	return tmp
+}
+
+// Build will run the provided go command for the provided Target and
+// return a BuildResult. If the go command produces a binary, the
+// BuildResult will contain an Artifact describing it.
+func (x *Compiler) Build(
+	t Target,
+	args ...string,
+) (*BuildResult, error) {
+	return x.BuildContext(context.Background(), t, args...)
+}
+
+// BuildContext is the same as Build, but the go command and any
+// processes it started will be killed if the context is canceled.
+func (x *Compiler) BuildContext(
+	ctx context.Context,
+	t Target,
+	args ...string,
+) (*BuildResult, error) {
+	var b []byte
+	var e error
+	var env map[string]string
+	var out string
+	var proc string
+	var r *BuildResult = &BuildResult{Target: t}
+	var start time.Time
+	var tmp []string
+
+	if env, e = x.SetupTargetEnvContext(ctx, t); e != nil {
+		r.Error = e.Error()
+		return r, e
+	}
+
+	// Choose the seed now, so the build can be repeated
+	if x.garbled(args) {
+		if x, e = x.seeded(); e != nil {
+			r.Error = e.Error()
+			return r, e
+		}
+
+		r.Garble = &x.GarbleOptions
+	}
+
+	proc, tmp = x.command(args)
+	r.Command = append([]string{proc}, tmp...)
+	r.Toolchain = Toolchain{
+		CC:        env["CC"],
+		CGO:       env["CGO_ENABLED"] == "1",
+		Compiler:  proc,
+		CXX:       env["CXX"],
+		GoVersion: env["GOVERSION"],
+	}
+
+	// Start with an empty GOCACHE, to verify against
+	if x.Verify && !x.Debug {
+		if env, e = tempCache(env); e != nil {
+			r.Error = e.Error()
+			return r, e
+		}
+		defer func() {
+			_ = os.RemoveAll(env["GOCACHE"])
+		}()
+	}
+
+	start = time.Now()
+	b, e = x.run(ctx, env, args, nil, x.Stdout, x.Stderr)
+	r.Duration = time.Since(start)
+	r.Stdout = strings.TrimSuffix(string(b), "\n")
+
+	if e != nil {
+		r.ExitStatus = -1
+
+		if xe, ok := e.(*ExitError); ok {
+			r.ExitStatus = xe.Code
+			xe.Target = t
+		}
+
+		r.Error = e.Error()
+
+		return r, e
+	}
+
+	if x.Debug {
+		return r, nil
+	}
+
+	if out, e = x.Output(env, args...); e != nil {
+		r.Error = e.Error()
+		return r, e
+	} else if out == "" {
+		return r, nil
+	}
+
+	if x.Verify {
+		start = time.Now()
+		e = x.verify(ctx, env, args, out)
+		r.Duration += time.Since(start)
+
+		if e != nil {
+			r.Error = e.Error()
+			r.ExitStatus = -1
+
+			return r, e
+		}
+	}
+
+	if r.Artifact, e = NewArtifact(out); e != nil {
+		r.Error = e.Error()
+		return r, e
+	}
+
+	return r, nil
+}
+
+// Output will return the path of the binary that the provided go
+// command will produce, if any.
+func (x *Compiler) Output(
+	env map[string]string,
+	args ...string,
+) (string, error) {
+	var a GoArgs
+	var e error
+	var name string
+	var out string
+	var pkgs []string
+	var stdout string
+
+	if (len(args) == 0) || (args[0] != "build") {
+		return "", nil
+	}
+
+	a = ParseGoArgs(args, "")
+	out, _ = a.Flag("o")
+
+	// An output file was explicitly provided
+	if out != "" {
+		if !strings.HasSuffix(out, "/") && !isDir(out) {
+			return out, nil
+		}
+	}
+
+	if pkgs = a.Packages; len(pkgs) == 0 {
+		pkgs = []string{"."}
+	}
+
+	switch {
+	case strings.HasSuffix(pkgs[0], ".go"):
+		name = strings.TrimSuffix(filepath.Base(pkgs[0]), ".go")
+	case len(pkgs) > 1:
+		// Go discards the results when building multiple packages
+		return "", nil
+	default:
+		stdout, e = x.query(
+			context.Background(),
+			env,
+			"list",
+			"-f",
+			"{{.Name}} {{.ImportPath}}",
+			pkgs[0],
+		)
+		if e != nil {
+			return "", e
+		}
+
+		if !strings.HasPrefix(stdout, "main ") {
+			return "", nil
+		}
+
+		name = path.Base(strings.TrimPrefix(stdout, "main "))
+		if majorVersion.MatchString(name) {
+			name = path.Base(
+				path.Dir(strings.TrimPrefix(stdout, "main ")),
+			)
+		}
+	}
+
+	if TargetFromEnv(env).OS == "windows" {
+		name += ".exe"
+	}
+
+	return filepath.Join(out, name), nil
+}
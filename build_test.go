@@ -0,0 +1,151 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var fn string = filepath.Join(t.TempDir(), "main")
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	r, e = x.Build(
+		xgo.HostTarget(),
+		"build",
+		"-o",
+		fn,
+		filepath.Join("testdata", "main.go"),
+	)
+	assert.NoError(t, e)
+	assert.NotNil(t, r)
+	assert.Equal(t, 0, r.ExitStatus)
+	assert.Equal(t, "go", r.Command[0])
+	assert.NotNil(t, r.Artifact)
+	assert.Equal(t, fn, r.Artifact.Path)
+	assert.Len(t, r.Artifact.SHA256, 64)
+	assert.Len(t, r.Artifact.SHA512, 128)
+	assert.Positive(t, r.Artifact.Size)
+
+	r, e = x.Build(
+		xgo.HostTarget(),
+		"build",
+		"-o",
+		fn,
+		filepath.Join("testdata", "missing.go"),
+	)
+	assert.Error(t, e)
+	assert.NotNil(t, r)
+	assert.NotEqual(t, 0, r.ExitStatus)
+	assert.Nil(t, r.Artifact)
+}
+
+func TestBuildVerify(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var fn string = filepath.Join(t.TempDir(), "main")
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{
+		Reproducible: true,
+		Verify:       true,
+	}
+
+	r, e = x.Build(
+		xgo.HostTarget(),
+		"build",
+		"--ldflags=-buildid=",
+		"--trimpath",
+		"-o",
+		fn,
+		filepath.Join("testdata", "main.go"),
+	)
+	assert.NoError(t, e)
+	assert.NotNil(t, r)
+	assert.Equal(t, 0, r.ExitStatus)
+	assert.NotNil(t, r.Artifact)
+	assert.Equal(t, fn, r.Artifact.Path)
+}
+
+func TestNewArtifact(t *testing.T) {
+	t.Parallel()
+
+	var a *xgo.Artifact
+	var e error
+	var fn string = filepath.Join(t.TempDir(), "empty")
+
+	assert.NoError(t, os.WriteFile(fn, nil, 0o600))
+
+	a, e = xgo.NewArtifact(fn)
+	assert.NoError(t, e)
+	assert.Equal(t, int64(0), a.Size)
+	assert.Equal(
+		t,
+		"e3b0c44298fc1c149afbf4c8996fb924"+
+			"27ae41e4649b934ca495991b7852b855",
+		a.SHA256,
+	)
+}
+
+func TestOutput(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var exe string
+	var out string
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+
+	out, e = x.Output(nil, "vet", ".")
+	assert.NoError(t, e)
+	assert.Empty(t, out)
+
+	out, e = x.Output(nil, "build", "-o", "bin/app", ".")
+	assert.NoError(t, e)
+	assert.Equal(t, "bin/app", out)
+
+	out, e = x.Output(nil, "build", "--o=bin/app", ".")
+	assert.NoError(t, e)
+	assert.Equal(t, "bin/app", out)
+
+	out, e = x.Output(nil, "build", "--tags", "a", "testdata/main.go")
+	assert.NoError(t, e)
+	assert.Equal(t, "main"+exe, out)
+
+	out, e = x.Output(nil, "build", "-o", "bin/", "./cmd/xgo")
+	assert.NoError(t, e)
+	assert.Equal(t, filepath.Join("bin", "xgo"+exe), out)
+
+	// Not a main package
+	out, e = x.Output(nil, "build", ".")
+	assert.NoError(t, e)
+	assert.Empty(t, out)
+}
+
+func TestSetOutput(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, xgo.SetOutput(nil, "a"))
+	assert.Equal(
+		t,
+		[]string{"build", "-o", "b", "-v", "."},
+		xgo.SetOutput([]string{"build", "-o", "a", "-v", "."}, "b"),
+	)
+	assert.Equal(
+		t,
+		[]string{"build", "-o", "b", "."},
+		xgo.SetOutput([]string{"build", "--o=a", "."}, "b"),
+	)
+}
@@ -0,0 +1,226 @@
+package xgo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Checksum is a struct containing a single entry from a checksum
+// file.
+type Checksum struct {
+	Algorithm string
+	Path      string
+	Sum       string
+}
+
+func parseChecksum(line string) (Checksum, error) {
+	var c Checksum
+	var escaped bool
+	var ok bool
+
+	// BSD tag format: ALGO (path) = sum
+	for _, algo := range []string{"SHA256", "SHA512"} {
+		if !strings.HasPrefix(line, algo+" (") {
+			continue
+		}
+
+		c.Algorithm = strings.ToLower(algo)
+		line = strings.TrimPrefix(line, algo+" (")
+
+		if idx := strings.LastIndex(line, ") = "); idx >= 0 {
+			c.Path = line[:idx]
+			c.Sum = line[idx+len(") = "):]
+
+			return c, c.validate()
+		}
+
+		return c, fmt.Errorf("invalid checksum line %q", line)
+	}
+
+	// coreutils format: sum  path (or sum *path for binary mode)
+	line, escaped = strings.CutPrefix(line, "\\")
+
+	if c.Sum, c.Path, ok = strings.Cut(line, " "); !ok {
+		return c, fmt.Errorf("invalid checksum line %q", line)
+	}
+
+	c.Path = strings.TrimPrefix(strings.TrimPrefix(c.Path, " "), "*")
+
+	if escaped {
+		c.Path = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(
+			c.Path,
+		)
+	}
+
+	switch len(c.Sum) {
+	case hex.EncodedLen(sha256.Size):
+		c.Algorithm = "sha256"
+	case hex.EncodedLen(sha512.Size):
+		c.Algorithm = "sha512"
+	}
+
+	return c, c.validate()
+}
+
+// ReadChecksums will parse a checksum file in either coreutils
+// (sha256sum) or BSD tag (sha256sum --tag) format. Paths are
+// resolved relative to the directory containing the checksum file.
+func ReadChecksums(fn string) ([]Checksum, error) {
+	var c Checksum
+	var e error
+	var f *os.File
+	var line string
+	var s *bufio.Scanner
+	var sums []Checksum
+
+	if f, e = os.Open(filepath.Clean(fn)); e != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", fn, e)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	s = bufio.NewScanner(f)
+	for s.Scan() {
+		if line = strings.TrimSuffix(s.Text(), "\r"); line == "" {
+			continue
+		}
+
+		if c, e = parseChecksum(line); e != nil {
+			return nil, fmt.Errorf("%s: %w", fn, e)
+		}
+
+		if !filepath.IsAbs(c.Path) {
+			c.Path = filepath.Join(filepath.Dir(fn), c.Path)
+		}
+
+		sums = append(sums, c)
+	}
+
+	if e = s.Err(); e != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fn, e)
+	}
+
+	return sums, nil
+}
+
+// WriteChecksums will write a checksum file for the provided
+// Artifacts, using the specified algorithm ("sha256" or "sha512").
+// Output is compatible with coreutils (sha256sum), or BSD tag format
+// (sha256sum --tag) if requested. Paths are written relative to the
+// directory containing the checksum file.
+func WriteChecksums(
+	fn string,
+	algo string,
+	tag bool,
+	artifacts ...*Artifact,
+) error {
+	var e error
+	var name string
+	var sb strings.Builder
+	var sum string
+
+	for _, a := range artifacts {
+		switch strings.ToLower(algo) {
+		case "sha256":
+			sum = a.SHA256
+		case "sha512":
+			sum = a.SHA512
+		default:
+			return fmt.Errorf("unsupported algorithm %s", algo)
+		}
+
+		name, e = filepath.Rel(filepath.Dir(fn), a.Path)
+		if e != nil {
+			return fmt.Errorf("failed to resolve %s: %w", a.Path, e)
+		}
+
+		name = filepath.ToSlash(name)
+
+		switch {
+		case tag:
+			sb.WriteString(
+				strings.ToUpper(algo) + " (" + name + ") = " + sum,
+			)
+		case strings.ContainsAny(name, "\\\n"):
+			// coreutils escapes these and prefixes the line
+			name = strings.ReplaceAll(name, "\\", "\\\\")
+			name = strings.ReplaceAll(name, "\n", "\\n")
+			sb.WriteString("\\" + sum + "  " + name)
+		default:
+			sb.WriteString(sum + "  " + name)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	//nolint:gosec,mnd // G306 - u=rw,go=r, checksums aren't secret
+	if e = os.WriteFile(fn, []byte(sb.String()), 0o644); e != nil {
+		return fmt.Errorf("failed to write %s: %w", fn, e)
+	}
+
+	return nil
+}
+
+func (c Checksum) validate() error {
+	if _, e := hex.DecodeString(c.Sum); e != nil {
+		return fmt.Errorf("invalid checksum for %s", c.Path)
+	}
+
+	switch {
+	case c.Path == "":
+		return fmt.Errorf("missing path for checksum %s", c.Sum)
+	case c.Algorithm == "sha256":
+		if len(c.Sum) == hex.EncodedLen(sha256.Size) {
+			return nil
+		}
+	case c.Algorithm == "sha512":
+		if len(c.Sum) == hex.EncodedLen(sha512.Size) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid checksum for %s", c.Path)
+}
+
+// Verify will return an error if the file does not match the
+// Checksum.
+func (c Checksum) Verify() error {
+	var e error
+	var f *os.File
+	var h hash.Hash
+
+	switch c.Algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported algorithm %s", c.Algorithm)
+	}
+
+	if f, e = os.Open(filepath.Clean(c.Path)); e != nil {
+		return fmt.Errorf("failed to open %s: %w", c.Path, e)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, e = io.Copy(h, f); e != nil {
+		return fmt.Errorf("failed to read %s: %w", c.Path, e)
+	}
+
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), c.Sum) {
+		return fmt.Errorf("checksum mismatch for %s", c.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestChecksums(t *testing.T) {
+	t.Parallel()
+
+	var artifacts []*xgo.Artifact
+	var dir string = t.TempDir()
+	var e error
+	var names []string = []string{"a", "b c", "d\\e"}
+	var sums []xgo.Checksum
+
+	for _, name := range names {
+		var a *xgo.Artifact
+		var fn string = filepath.Join(dir, "dist", name)
+
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0o700))
+		assert.NoError(t, os.WriteFile(fn, []byte(name), 0o600))
+
+		a, e = xgo.NewArtifact(fn)
+		assert.NoError(t, e)
+
+		artifacts = append(artifacts, a)
+	}
+
+	for _, algo := range []string{"sha256", "sha512"} {
+		for _, tag := range []bool{false, true} {
+			var fn string = filepath.Join(dir, "dist", algo+"SUMS")
+
+			e = xgo.WriteChecksums(fn, algo, tag, artifacts...)
+			assert.NoError(t, e)
+
+			sums, e = xgo.ReadChecksums(fn)
+			assert.NoError(t, e)
+			assert.Len(t, sums, len(artifacts))
+
+			for i, sum := range sums {
+				assert.Equal(t, algo, sum.Algorithm)
+				assert.Equal(t, artifacts[i].Path, sum.Path)
+				assert.NoError(t, sum.Verify())
+			}
+		}
+	}
+
+	// Tamper with an artifact
+	assert.NoError(
+		t,
+		os.WriteFile(artifacts[0].Path, []byte("tampered"), 0o600),
+	)
+
+	sums, e = xgo.ReadChecksums(
+		filepath.Join(dir, "dist", "sha256SUMS"),
+	)
+	assert.NoError(t, e)
+	assert.Error(t, sums[0].Verify())
+}
+
+func TestReadChecksumsInvalid(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var fn string = filepath.Join(t.TempDir(), "SHA256SUMS")
+
+	assert.NoError(t, os.WriteFile(fn, []byte("abc  file\n"), 0o600))
+
+	_, e = xgo.ReadChecksums(fn)
+	assert.Error(t, e)
+}
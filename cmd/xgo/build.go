@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mjwhitta/log"
+	"github.com/mjwhitta/xgo"
+)
+
+// Run the go command for each target, optionally writing a report
+func build(
+	ctx context.Context,
+	x *xgo.Compiler,
+	targets []xgo.Target,
+	args []string,
+) {
+	var e error
+	var extras []string
+	var failed int
+	var first error
+	var mtime time.Time = xgo.SourceDateEpoch()
+	var out string
+	var r *xgo.BuildResult
+	var results []*xgo.BuildResult
+	var tmp []string
+	var total int
+	var universal xgo.Target = xgo.Target{
+		OS:   "darwin",
+		Arch: "universal",
+	}
+	var xe *xgo.ExitError
+
+	for _, list := range flags.archives {
+		for extra := range strings.SplitSeq(list, ",") {
+			if extra = strings.TrimSpace(extra); extra != "" {
+				extras = append(extras, extra)
+			}
+		}
+	}
+
+	// Darwin targets are replaced by a single universal build
+	if flags.universal {
+		targets = universalTargets(targets)
+		total++
+	}
+
+	total += len(targets)
+
+	// Each target needs its own output file
+	if total > 1 {
+		out = outputName(ctx, x, targets, args)
+	}
+
+	for i := range total {
+		// Stop early, if interrupted or timed out
+		if ctx.Err() != nil {
+			panic(canceled(ctx, ctx.Err()))
+		}
+
+		if i < len(targets) {
+			tmp = targetArgs(args, targets[i], out)
+
+			// Tests that can't run on this host fail the target,
+			// unless skipped
+			tmp, e = testArgs(ctx, x, targets[i], tmp)
+			if skipTests(e) {
+				continue
+			} else if e != nil {
+				r = &xgo.BuildResult{
+					Error:  e.Error(),
+					Target: targets[i],
+				}
+			} else {
+				r, e = x.BuildContext(ctx, targets[i], tmp...)
+			}
+		} else {
+			tmp = targetArgs(args, universal, "")
+			r, e = x.BuildUniversalContext(ctx, tmp...)
+		}
+
+		results = append(results, r)
+
+		if r.Stdout != "" {
+			fmt.Println(r.Stdout)
+		}
+
+		if (e == nil) && (flags.smoke != "") && (r.Artifact != nil) {
+			e = smoke(ctx, x, r)
+		}
+
+		e = canceled(ctx, e)
+
+		if e != nil {
+			if total > 1 {
+				logFailure(r.Target, e)
+			}
+
+			if first == nil {
+				first = e
+			}
+
+			failed++
+
+			continue
+		}
+
+		if flags.verbose && (r.Artifact != nil) {
+			log.Goodf("%s: %s", r.Target, r.Artifact.Path)
+		}
+
+		if (flags.archive != "") && (r.Artifact != nil) {
+			e = r.Package(flags.archive, mtime, extras...)
+			if e != nil {
+				if total > 1 {
+					logFailure(r.Target, e)
+				}
+
+				if first == nil {
+					first = e
+				}
+
+				failed++
+
+				continue
+			}
+
+			if flags.verbose {
+				log.Goodf("%s: %s", r.Target, r.Archive.Path)
+			}
+		}
+	}
+
+	if flags.report != "" {
+		e = xgo.NewReport(results...).Write(flags.report)
+		if e != nil {
+			panic(e)
+		}
+	}
+
+	if flags.checksums != "" {
+		writeChecksums(results)
+	}
+
+	switch {
+	case failed == 0:
+	case total == 1:
+		panic(first)
+	case errors.Is(first, xgo.ErrNoRunner):
+		log.ErrXf(NoRunner, "%d targets failed", failed)
+	case errors.As(first, &xe):
+		// Exit with the first failed go command's status
+		log.ErrXf(exitCode(xe), "%d targets failed", failed)
+	default:
+		log.ErrXf(Exception, "%d targets failed", failed)
+	}
+}
+
+// Log a failed target, without repeating stderr that was already
+// streamed to the terminal
+func logFailure(t xgo.Target, e error) {
+	var xe *xgo.ExitError
+
+	if errors.As(e, &xe) && xe.Streamed {
+		log.Errf(
+			"%s: %s exited with status %d",
+			t,
+			xe.Command[0],
+			xe.Code,
+		)
+
+		return
+	}
+
+	log.Errf("%s: %s", t, e)
+}
+
+// Parse comma-separated target lists, keeping variant options (e.g.
+// "linux/arm/7,softfloat") attached to their target
+// Return the output name of the go command, resolved with the env of
+// the first target (or darwin/amd64), as packages may only build for
+// some targets.
+func outputName(
+	ctx context.Context,
+	x *xgo.Compiler,
+	targets []xgo.Target,
+	args []string,
+) string {
+	var e error
+	var env map[string]string
+	var out string
+	var t xgo.Target = xgo.Target{OS: "darwin", Arch: "amd64"}
+
+	if len(targets) > 0 {
+		t = targets[0]
+	}
+
+	if env, e = x.SetupTargetEnvContext(ctx, t); e != nil {
+		panic(canceled(ctx, e))
+	}
+
+	if out, e = x.Output(env, args...); e != nil {
+		panic(e)
+	}
+
+	return out
+}
+
+func parseTargets(lists []string) ([]xgo.Target, error) {
+	var e error
+	var specs []string
+	var t xgo.Target
+	var targets []xgo.Target
+
+	for _, list := range lists {
+		for spec := range strings.SplitSeq(list, ",") {
+			switch {
+			case strings.TrimSpace(spec) == "":
+			case !strings.Contains(spec, "/") && (len(specs) > 0):
+				specs[len(specs)-1] += "," + spec
+			default:
+				specs = append(specs, spec)
+			}
+		}
+	}
+
+	for _, spec := range specs {
+		if t, e = xgo.ParseTarget(spec); e != nil {
+			return nil, e
+		}
+
+		targets = append(targets, t)
+	}
+
+	return targets, nil
+}
+
+// Run the artifact with the --smoke args, warning if there's no
+// runner for the target
+func smoke(
+	ctx context.Context,
+	x *xgo.Compiler,
+	r *xgo.BuildResult,
+) error {
+	var args []string = strings.Fields(flags.smoke)
+	var e error
+	var timeout time.Duration
+
+	// Already validated
+	timeout, _ = time.ParseDuration(flags.smokeWait)
+
+	e = x.SmokeContext(ctx, r, timeout, args...)
+	if errors.Is(e, xgo.ErrNoRunner) {
+		log.Warnf("Skipping smoke test: %s", e.Error())
+		return nil
+	} else if e != nil {
+		return e
+	}
+
+	if flags.verbose {
+		for _, line := range r.Smoke.Output {
+			log.Infof("%s: %s", r.Target, line)
+		}
+	}
+
+	return nil
+}
+
+// Add -exec to go test, if the target needs a runner, setting up the
+// target's env only for tests
+func testArgs(
+	ctx context.Context,
+	x *xgo.Compiler,
+	t xgo.Target,
+	args []string,
+) ([]string, error) {
+	var e error
+	var env map[string]string
+
+	if args[0] != "test" {
+		return args, nil
+	}
+
+	if env, e = x.SetupTargetEnvContext(ctx, t); e != nil {
+		return nil, e //nolint:wrapcheck // Nothing to add
+	}
+
+	return runnerArgs(x, t, env, args)
+}
+
+// Remove the darwin targets, which are replaced by the universal
+// build, and reject --targets without any darwin targets
+func universalTargets(targets []xgo.Target) []xgo.Target {
+	var n int = len(targets)
+
+	targets = slices.DeleteFunc(
+		targets,
+		func(t xgo.Target) bool {
+			return t.OS == "darwin"
+		},
+	)
+
+	if (n > 0) && (len(targets) == n) {
+		log.ErrX(
+			InvalidOption,
+			"--universal requires a darwin target in --targets",
+		)
+	}
+
+	return targets
+}
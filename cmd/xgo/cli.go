@@ -1,13 +1,16 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
+	"time"
 
 	"github.com/mjwhitta/cli"
 	hl "github.com/mjwhitta/hilighter"
+	"github.com/mjwhitta/log"
 	"github.com/mjwhitta/xgo"
 )
 
@@ -20,18 +23,53 @@ const (
 	MissingArgument
 	ExtraArgument
 	Exception
+	NoRunner
 )
 
+// Config, loaded from a file (see xgo.FindConfig)
+var config *xgo.Config
+
+// Flags required for reproducible builds, in addition to the profile
+var reproducible xgo.Profile = xgo.Profile{
+	"ldflags":  "-buildid=",
+	"trimpath": "",
+}
+
 // Flags
 var flags struct {
-	check   bool
-	debug   bool
-	garble  bool
-	goarch  string
-	goos    string
-	nocolor bool
-	verbose bool
-	version bool
+	archive     string
+	archives    cli.StringList
+	check       bool
+	checksums   string
+	debug       bool
+	debugEnv    cli.StringList
+	garble      bool
+	garbleDir   string
+	garbleFlags string
+	garbleSeed  string
+	goarch      string
+	goos        string
+	nocolor     bool
+	noLiterals  bool
+	noMerge     bool
+	noTiny      bool
+	profile     string
+	repro       bool
+	report      string
+	skipTests   bool
+	smoke       string
+	smokeWait   string
+	stamp       bool
+	stampVars   cli.StringList
+	tag         bool
+	target      string
+	targets     cli.StringList
+	timeout     string
+	trace       bool
+	universal   bool
+	verbose     bool
+	verifyRepro bool
+	version     bool
 }
 
 func init() {
@@ -50,17 +88,54 @@ func init() {
 		fmt.Sprintf("  %d: Invalid argument\n", InvalidArgument),
 		fmt.Sprintf("  %d: Missing argument\n", MissingArgument),
 		fmt.Sprintf("  %d: Extra argument\n", ExtraArgument),
-		fmt.Sprintf("  %d: Exception", Exception),
+		fmt.Sprintf("  %d: Exception\n", Exception),
+		fmt.Sprintf("  %d: No test runner\n\n", NoRunner),
+		"If the go command itself fails, the exit status will be",
+		"the go command's exit status.",
 	)
 	cli.Info(
 		"This tool aims to simplify cross-compiling Go with or",
 		"without CGO support.",
 	)
 
+	cli.SectionAligned(
+		"SUBCOMMANDS",
+		"|",
+		"env [flags]|Print the env vars xgo changes for the target",
+		"(--target), or all of them (--all), using --format sh",
+		"(default), fish, powershell, cmd, dotenv, json, make, or",
+		"github. Without these flags, go env is run instead.\n",
+		"reverse [flags] [files]|De-obfuscate garble stack traces",
+		"(from files, or stdin), using the garble options and build",
+		"flags of the target (--target) in a build report",
+		"(--report), or a seed (--seed), followed by -- and any",
+		"build flags and package.\n",
+		"script [flags] [gocommand]|Print a standalone script that",
+		"runs the same builds as xgo (--targets), using --shell",
+		"bash (default) or powershell.\n",
+		"verify <file>|Verify a checksum file created with",
+		"--checksums.",
+	)
+
 	cli.SeeAlso = []string{"gcc", "go", "mingw", "osxcross-git"}
 	cli.Title = "XGo"
 
 	// Parse cli flags
+	cli.Flag(
+		&flags.archive,
+		"a",
+		"archive",
+		"",
+		"Package each built artifact into an archive (tar.gz or",
+		"zip, windows targets always use zip). There's no tar.xz,",
+		"as the standard library has no xz writer.",
+	)
+	cli.Flag(
+		&flags.archives,
+		"archive-files",
+		"Extra files to add to each archive (e.g. README.md or",
+		"LICENSE, comma-separated, can be used more than once).",
+	)
 	cli.Flag(
 		&flags.check,
 		"c",
@@ -68,18 +143,50 @@ func init() {
 		false,
 		"Check for missing toolchains.",
 	)
+	cli.Flag(
+		&flags.checksums,
+		"checksums",
+		"",
+		"Write a checksum file (e.g. SHA256SUMS or SHA512SUMS) for",
+		"all built artifacts.",
+	)
+	cli.Flag(
+		&flags.tag,
+		"checksums-tag",
+		false,
+		"Use BSD tag format for --checksums.",
+	)
 	cli.Flag(&flags.debug, "d", "debug", false, "n/a", true)
+	cli.Flag(
+		&flags.debugEnv,
+		"debug-env",
+		"Env vars to show with --debug or --trace: changed",
+		"(default, vars that differ from Go's defaults), all, or a",
+		"comma-separated list of names or globs (can be used more",
+		"than once).",
+	)
 	cli.Flag(&flags.garble, "g", "garble", false, "n/a", true)
+	cli.Flag(&flags.garbleDir, "garble-debugdir", "", "n/a", true)
+	cli.Flag(&flags.garbleFlags, "garble-flags", "", "n/a", true)
+	cli.Flag(&flags.garbleSeed, "garble-seed", "", "n/a", true)
+	cli.Flag(
+		&flags.noLiterals,
+		"no-garble-literals",
+		false,
+		"n/a",
+		true,
+	)
+	cli.Flag(&flags.noTiny, "no-garble-tiny", false, "n/a", true)
 	cli.Flag(
 		&flags.goarch,
 		"goarch",
-		runtime.GOARCH,
+		"",
 		"Set the GOARCH env var (useful for Windows).",
 	)
 	cli.Flag(
 		&flags.goos,
 		"goos",
-		runtime.GOOS,
+		"",
 		"Set the GOOS env var (useful for Windows).",
 	)
 	cli.Flag(
@@ -88,19 +195,136 @@ func init() {
 		false,
 		"Disable colorized output.",
 	)
+	cli.Flag(
+		&flags.noMerge,
+		"no-merge",
+		false,
+		"Don't merge default flags (e.g. -s -w) into the provided",
+		"-ldflags, -gcflags, or -tags.",
+	)
+	cli.Flag(
+		&flags.profile,
+		"p",
+		"profile",
+		"",
+		"Default build flags to use: release (default, -s -w,",
+		"-trimpath, and -buildvcs=false), debug (keep symbols,",
+		"-gcflags=all=-N -l), hardened (release, plus PIE and full",
+		"RELRO), minimal (none), or a profile from the config.",
+	)
+	cli.Flag(
+		&flags.repro,
+		"reproducible",
+		false,
+		"Pin SOURCE_DATE_EPOCH (to the commit time, if unset),",
+		"-buildid=, and -trimpath, clear host-specific env vars, and",
+		"disable garble's random seed.",
+	)
+	cli.Flag(
+		&flags.report,
+		"r",
+		"report",
+		"",
+		"Write a JSON build report (command, toolchain, status,",
+		"duration, and artifact size and hashes) to the specified",
+		"file.",
+	)
+	cli.Flag(
+		&flags.skipTests,
+		"skip-no-runner",
+		false,
+		"Skip tests for targets without a runner (e.g. qemu or",
+		"wine), instead of failing.",
+	)
+	cli.Flag(
+		&flags.smoke,
+		"smoke",
+		"",
+		"Run each built artifact with the provided space-separated",
+		"args (e.g. --smoke=--version), through qemu or wine if",
+		"needed, and fail if it doesn't exit 0.",
+	)
+	cli.Flag(
+		&flags.smokeWait,
+		"smoke-timeout",
+		"10s",
+		"Kill each --smoke run if it runs longer than the specified",
+		"duration.",
+	)
+	cli.Flag(
+		&flags.stamp,
+		"stamp",
+		false,
+		"Stamp the git version, commit, and commit time into",
+		"main.version, main.commit, and main.date with -X, or",
+		"into the vars from --stamp-var or the config.",
+	)
+	cli.Flag(
+		&flags.stampVars,
+		"stamp-var",
+		"Var to stamp, and its template (e.g. main.v={{.Version}},",
+		"implies --stamp, can be used more than once).",
+	)
+	cli.Flag(
+		&flags.target,
+		"t",
+		"target",
+		"",
+		"Set the target as os/arch[/variant] (overrides GOOS,",
+		"GOARCH, GOARM, etc.).",
+	)
+	cli.Flag(
+		&flags.targets,
+		"targets",
+		"Build for multiple targets (comma-separated",
+		"os/arch[/variant] list, can be used more than once).",
+	)
+	cli.Flag(
+		&flags.timeout,
+		"timeout",
+		"",
+		"Kill the go command if it runs longer than the specified",
+		"duration (e.g. 90s or 10m).",
+	)
+	cli.Flag(
+		&flags.trace,
+		"trace",
+		false,
+		"Show each go command (and its env) on stderr before",
+		"running it, and how long it took afterward.",
+	)
+	cli.Flag(
+		&flags.universal,
+		"u",
+		"universal",
+		false,
+		"Build darwin/amd64 and darwin/arm64 and merge them into a",
+		"single universal binary (replaces the darwin targets in",
+		"--targets, which must include one).",
+	)
 	cli.Flag(
 		&flags.verbose,
 		"v",
 		"verbose",
 		false,
-		"Show stacktrace, if error.",
+		"Show resolved target and stacktrace, if error.",
+	)
+	cli.Flag(
+		&flags.verifyRepro,
+		"verify-reproducible",
+		false,
+		"Build each artifact twice, with separate, empty GOCACHEs,",
+		"and fail if they differ (implies --reproducible).",
 	)
 	cli.Flag(&flags.version, "V", "version", false, "Show version.")
-	cli.Parse()
 }
 
-// Process cli flags and ensure no issues
+// Parse cli flags and ensure no issues
 func validate() {
+	var e error
+
+	cli.Parse()
+
 	hl.Disable(flags.nocolor)
 
 	// Short circuit, if version was requested
@@ -111,7 +335,133 @@ func validate() {
 		os.Exit(Good)
 	}
 
+	// Load config, if any
+	if config, e = xgo.LoadConfig(xgo.FindConfig()); e != nil {
+		log.ErrX(InvalidOption, e.Error())
+	}
+
 	// Validate cli flags
+	switch flags.archive {
+	case "", "tar.gz", "zip":
+	case "tar.xz":
+		log.ErrX(
+			InvalidOption,
+			"tar.xz isn't supported, as the standard library has no "+
+				"xz writer",
+		)
+	default:
+		log.ErrXf(
+			InvalidOption,
+			"unsupported archive format %s",
+			flags.archive,
+		)
+	}
+
+	if len(flags.targets) > 0 {
+		if (flags.goarch != "") || (flags.goos != "") {
+			log.ErrX(
+				InvalidOption,
+				"--targets can't be used with --goarch or --goos",
+			)
+		} else if flags.target != "" {
+			log.ErrX(
+				InvalidOption,
+				"--targets can't be used with --target",
+			)
+		}
+
+		if _, e := parseTargets(flags.targets); e != nil {
+			log.ErrX(InvalidOption, e.Error())
+		}
+	}
+
+	if flags.garbleSeed == "" {
+		flags.garbleSeed = os.Getenv("XGOGARBLESEED")
+	}
+
+	if flags.garbleSeed == "" {
+		flags.garbleSeed = config.Garble.Seed
+	}
+
+	switch flags.garbleSeed {
+	case "", "random":
+	default:
+		// Same format as garble: at least 8 bytes, base64
+		b, e := base64.RawStdEncoding.DecodeString(
+			strings.TrimRight(flags.garbleSeed, "="),
+		)
+		if (e != nil) || (len(b) < 8) { //nolint:mnd // See above
+			log.ErrXf(
+				InvalidOption,
+				"invalid garble seed %s",
+				flags.garbleSeed,
+			)
+		}
+	}
+
+	if flags.profile == "" {
+		flags.profile = os.Getenv("XGOPROFILE")
+	}
+
+	if flags.profile == "" {
+		flags.profile = "release"
+	}
+
+	if _, e = config.Profile(flags.profile); e != nil {
+		log.ErrX(InvalidOption, e.Error())
+	}
+
+	if d, e := time.ParseDuration(flags.smokeWait); e != nil {
+		log.ErrXf(
+			InvalidOption,
+			"invalid smoke timeout %s",
+			flags.smokeWait,
+		)
+	} else if d <= 0 {
+		log.ErrX(InvalidOption, "--smoke-timeout must be positive")
+	}
+
+	for _, kv := range flags.stampVars {
+		if k, _, ok := strings.Cut(kv, "="); !ok || (k == "") {
+			log.ErrXf(InvalidOption, "invalid stamp var %s", kv)
+		}
+	}
+
+	if flags.timeout != "" {
+		if d, e := time.ParseDuration(flags.timeout); e != nil {
+			log.ErrXf(
+				InvalidOption,
+				"invalid timeout %s",
+				flags.timeout,
+			)
+		} else if d <= 0 {
+			log.ErrX(InvalidOption, "--timeout must be positive")
+		}
+	}
+
+	if flags.universal {
+		switch {
+		case (flags.goos != "") && (flags.goos != "darwin"):
+			log.ErrX(InvalidOption, "--universal requires darwin")
+		case flags.target == "":
+		case !strings.HasPrefix(flags.target, "darwin/"):
+			log.ErrX(InvalidOption, "--universal requires darwin")
+		}
+	}
+
+	if flags.target != "" {
+		if (flags.goarch != "") || (flags.goos != "") {
+			log.ErrX(
+				InvalidOption,
+				"--target can't be used with --goarch or --goos",
+			)
+		}
+
+		if _, e := xgo.ParseTarget(flags.target); e != nil {
+			log.ErrX(InvalidOption, e.Error())
+		}
+	}
+
 	if flags.check {
 		if cli.NArg() > 0 {
 			cli.Usage(ExtraArgument)
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mjwhitta/log"
+	"github.com/mjwhitta/xgo"
+)
+
+// Return true if any xgo env flags were provided, otherwise the args
+// should be passed to go env
+func envFlags(args []string) bool {
+	var name string
+
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name, _, _ = strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		switch name {
+		case "all", "format", "target":
+			return true
+		}
+	}
+
+	return false
+}
+
+// Print the cross environment for the target in the requested format
+func printEnv(
+	ctx context.Context,
+	x *xgo.Compiler,
+	t xgo.Target,
+	args []string,
+) {
+	var all bool
+	var e error
+	var env map[string]string
+	var format string
+	var fs *flag.FlagSet
+	var host map[string]string
+	var out string
+	var target string
+
+	fs = flag.NewFlagSet("env", flag.ContinueOnError)
+	fs.BoolVar(&all, "all", false, "")
+	fs.StringVar(&format, "format", "sh", "")
+	fs.StringVar(&target, "target", "", "")
+	fs.SetOutput(io.Discard)
+
+	if e = fs.Parse(args); e != nil {
+		log.ErrX(InvalidOption, e.Error())
+	} else if fs.NArg() > 0 {
+		log.ErrXf(ExtraArgument, "unexpected argument %s", fs.Arg(0))
+	}
+
+	// Validate format before running the go command
+	if _, e = xgo.FormatEnv(nil, format); e != nil {
+		log.ErrX(InvalidOption, e.Error())
+	}
+
+	if target != "" {
+		if t, e = xgo.ParseTarget(target); e != nil {
+			log.ErrX(InvalidOption, e.Error())
+		}
+	}
+
+	if env, e = x.SetupTargetEnvContext(ctx, t); e != nil {
+		panic(canceled(ctx, e))
+	}
+
+	// Only show what xgo changed, unless all were requested
+	if !all {
+		if host, e = x.HostEnvContext(ctx); e != nil {
+			panic(canceled(ctx, e))
+		}
+
+		env = xgo.ChangedEnv(env, host)
+	}
+
+	if out, e = xgo.FormatEnv(env, format); e != nil {
+		panic(e)
+	}
+
+	if out != "" {
+		fmt.Println(out)
+	}
+}
@@ -3,11 +3,17 @@ package main
 //go:generate goversioninfo --platform-specific
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mjwhitta/cli"
 	"github.com/mjwhitta/log"
@@ -23,9 +29,116 @@ func booleanLike(name string) bool {
 	return true
 }
 
+// Return a friendlier error, if the context was canceled
+func canceled(ctx context.Context, e error) error {
+	switch {
+	case e == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timed out after %s", flags.timeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return errors.New("interrupted")
+	}
+
+	return e
+}
+
+// Return the env vars (or globs) to show with --debug or --trace
+func debugEnv() []string {
+	var keep []string
+	var lists []string = flags.debugEnv
+
+	if len(lists) == 0 {
+		lists = []string{os.Getenv("XGODEBUGENV")}
+	}
+
+	for _, list := range lists {
+		for name := range strings.SplitSeq(list, ",") {
+			switch name = strings.TrimSpace(name); name {
+			case "":
+			case "all":
+				return []string{"*"}
+			case "changed":
+				return nil
+			default:
+				keep = append(keep, name)
+			}
+		}
+	}
+
+	return keep
+}
+
+// Return the garble options from the cli flags, then env vars, then
+// the config
+func garbleOptions() xgo.GarbleOptions {
+	var extra string = flags.garbleFlags
+	var o xgo.GarbleOptions = config.Garble
+
+	if flags.garbleDir != "" {
+		o.DebugDir = flags.garbleDir
+	} else if dir := os.Getenv("XGOGARBLEDEBUGDIR"); dir != "" {
+		o.DebugDir = dir
+	}
+
+	if extra == "" {
+		extra = os.Getenv("XGOGARBLEFLAGS")
+	}
+
+	// Space-separated, like GOFLAGS
+	if extra != "" {
+		o.Flags = strings.Fields(extra)
+	}
+
+	o.NoLiterals = o.NoLiterals || flags.noLiterals ||
+		booleanLike("XGOGARBLENOLITERALS")
+	o.NoTiny = o.NoTiny || flags.noTiny ||
+		booleanLike("XGOGARBLENOTINY")
+
+	// Already resolved and validated
+	o.Seed = flags.garbleSeed
+
+	return o
+}
+
+// Return the go command's exit status, or Exception if it was killed
+// by a signal
+func exitCode(xe *xgo.ExitError) int {
+	if xe.Code <= 0 {
+		return Exception
+	}
+
+	return xe.Code
+}
+
+func lookup(val string, flag string, key string) (string, string) {
+	if val != "" {
+		return val, key + " from " + flag
+	}
+
+	if val = os.Getenv(key); val != "" {
+		return val, key + " from env"
+	}
+
+	return "", ""
+}
+
 func main() {
 	defer func() {
 		if r := recover(); r != nil {
+			var xe *xgo.ExitError
+
+			// Exit with the go command's own status
+			if e, ok := r.(error); ok && errors.As(e, &xe) {
+				if xe.Streamed {
+					os.Exit(exitCode(xe))
+				}
+
+				log.ErrX(exitCode(xe), xe.Error())
+			} else if ok && errors.Is(e, xgo.ErrNoRunner) {
+				log.ErrX(NoRunner, e.Error())
+			}
+
 			if flags.verbose {
 				panic(r)
 			}
@@ -40,15 +153,35 @@ func main() {
 	}()
 
 	var args []string
+	var cancel context.CancelFunc
+	var ctx context.Context
 	var e error
 	var env map[string]string
 	var keys []string
 	var missing map[string][]string
-	var stdout string
+	var src string
+	var targets []xgo.Target
+	var timeout time.Duration
 	var x *xgo.Compiler
 
 	validate()
 
+	// Cancel cleanly on SIGINT/SIGTERM, or when the timeout expires
+	ctx, cancel = signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	defer cancel()
+
+	if flags.timeout != "" {
+		// Already validated
+		timeout, _ = time.ParseDuration(flags.timeout)
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	if flags.check {
 		missing = xgo.MissingToolchains()
 
@@ -69,38 +202,248 @@ func main() {
 		return
 	}
 
-	// Get env vars or default to runtime
-	if flags.goarch = os.Getenv("GOARCH"); flags.goarch == "" {
-		flags.goarch = runtime.GOARCH
+	// Handle xgo subcommands
+	switch cli.Arg(0) {
+	case "verify":
+		verify(cli.Args()[1:])
+		return
+	}
+
+	// Get targets from cli flags, then env vars, then runtime
+	if targets, src, e = resolveTargets(); e != nil {
+		panic(e)
 	}
 
-	if flags.goos = os.Getenv("GOOS"); flags.goos == "" {
-		flags.goos = runtime.GOOS
+	if flags.verbose {
+		for _, t := range targets {
+			log.Infof("Target %s (%s)", t, src)
+		}
 	}
 
 	// Enable debug, if requested
 	flags.debug = flags.debug || booleanLike("XGODEBUG")
 	flags.garble = flags.garble || booleanLike("XGOGARBLE")
+	flags.noMerge = flags.noMerge || booleanLike("XGONOMERGE")
+	flags.repro = flags.repro || booleanLike("XGOREPRODUCIBLE")
+	flags.stamp = flags.stamp || booleanLike("XGOSTAMP")
+	flags.trace = flags.trace || booleanLike("XGOTRACE")
+	flags.verifyRepro = flags.verifyRepro ||
+		booleanLike("XGOVERIFYREPRODUCIBLE")
+	flags.repro = flags.repro || flags.verifyRepro
 	x = &xgo.Compiler{
-		Debug:  flags.debug,
-		Garble: flags.garble,
-		Zig:    booleanLike("XGOZIG"),
+		Debug:         flags.debug,
+		DebugEnv:      debugEnv(),
+		Garble:        flags.garble,
+		GarbleOptions: garbleOptions(),
+		Reproducible:  flags.repro,
+		Runners:       config.Runners,
+		Stderr:        os.Stderr,
+		Stdin:         os.Stdin,
+		Stdout:        os.Stdout,
+		Verify:        flags.verifyRepro,
+		Zig:           booleanLike("XGOZIG"),
+	}
+
+	if flags.repro {
+		pinSourceDateEpoch()
+	}
+
+	if flags.trace {
+		x.Trace = os.Stderr
+	}
+
+	// Handle xgo env, if any xgo env flags were provided, otherwise
+	// fall through to go env
+	if (cli.Arg(0) == "env") && envFlags(cli.Args()[1:]) {
+		if len(targets) != 1 {
+			log.ErrX(InvalidOption, "env requires a single target")
+		}
+
+		printEnv(ctx, x, targets[0], cli.Args()[1:])
+
+		return
+	}
+
+	// Handle xgo reverse and xgo script
+	switch cli.Arg(0) {
+	case "reverse":
+		reverse(ctx, x, targets[0], cli.Args()[1:])
+		return
+	case "script":
+		script(ctx, x, targets, cli.Args()[1:])
+		return
+	}
+
+	if flags.garble && !xgo.GarbleSupports(cli.Arg(0)) {
+		log.Warnf(
+			"garble doesn't support go %s, running it without garble",
+			cli.Arg(0),
+		)
 	}
 
 	// Preprocess cli args for some special cases
-	args = xgo.BuildArgsSanityCheck(cli.Args())
+	args = sanityCheck(cli.Args())
 
-	// Get env for specified GOOS/GOARCH
-	if env, e = x.SetupEnv(flags.goos, flags.goarch); e != nil {
-		panic(e)
+	// Build each target, if archives, checksums, a report, smoke
+	// tests, verification, or a universal binary were requested, or
+	// multiple targets were provided
+	if flags.universal && (len(flags.targets) == 0) {
+		build(ctx, x, nil, args)
+		return
+	} else if (len(targets) > 1) || flags.universal ||
+		flags.verifyRepro || (flags.archive+flags.checksums != "") ||
+		(flags.report+flags.smoke != "") {
+		build(ctx, x, targets, args)
+		return
 	}
 
-	// Run Go command
-	if stdout, e = x.Run(env, args...); e != nil {
+	args = targetArgs(args, targets[0], "")
+
+	// Get env for specified GOOS/GOARCH/variant
+	if env, e = x.SetupTargetEnvContext(ctx, targets[0]); e != nil {
+		panic(canceled(ctx, e))
+	}
+
+	if args, e = runnerArgs(x, targets[0], env, args); e != nil {
+		if skipTests(e) {
+			return
+		}
+
 		panic(e)
 	}
 
-	if stdout != "" {
-		fmt.Println(stdout)
+	// Run Go command, attached to the terminal for subcommands that
+	// may be interactive, otherwise streaming output to the terminal
+	switch args[0] {
+	case "generate", "mod", "run", "test":
+		e = x.AttachContext(ctx, env, args...)
+	default:
+		e = x.StreamContext(ctx, env, args...)
+	}
+
+	if e != nil {
+		panic(canceled(ctx, e))
+	}
+}
+
+// Return true if the tests should be skipped, because there's no
+// runner for the target and --skip-no-runner was provided
+func skipTests(e error) bool {
+	if !flags.skipTests || !errors.Is(e, xgo.ErrNoRunner) {
+		return false
+	}
+
+	log.Warnf("Skipping tests: %s", e.Error())
+
+	return true
+}
+
+// Set SOURCE_DATE_EPOCH to the commit time, if unset and available
+func pinSourceDateEpoch() {
+	if os.Getenv("SOURCE_DATE_EPOCH") != "" {
+		return
+	}
+
+	if readGitInfo(); vcs.info == nil {
+		return
+	}
+
+	_ = os.Setenv(
+		"SOURCE_DATE_EPOCH",
+		strconv.FormatInt(vcs.info.CommitTime.Unix(), 10),
+	)
+}
+
+// Resolve the target from the cli flags, then env vars, then runtime
+func resolveTarget() (xgo.Target, string, error) {
+	var e error
+	var src []string
+	var t xgo.Target
+	var tmp string
+	var variant string
+
+	if flags.target != "" {
+		t, e = xgo.ParseTarget(flags.target)
+		return t, "from --target", e
+	}
+
+	if t.OS, tmp = lookup(flags.goos, "--goos", "GOOS"); tmp != "" {
+		src = append(src, tmp)
+	} else {
+		t.OS = runtime.GOOS
+		src = append(src, "GOOS from runtime")
+	}
+
+	t.Arch, tmp = lookup(flags.goarch, "--goarch", "GOARCH")
+	if tmp != "" {
+		src = append(src, tmp)
+	} else {
+		t.Arch = runtime.GOARCH
+		src = append(src, "GOARCH from runtime")
+	}
+
+	// Get variant for GOARCH, if any (GOARM, etc.)
+	if variant, tmp = lookup("", "", t.EnvVar()); tmp != "" {
+		src = append(src, tmp)
+
+		t, e = xgo.ParseTarget(t.String() + "/" + variant)
+		if e != nil {
+			return t, "", e
+		}
+	}
+
+	return t, strings.Join(src, ", "), nil
+}
+
+// Resolve the targets from --targets, or the single target from the
+// cli flags, then env vars, then runtime
+func resolveTargets() ([]xgo.Target, string, error) {
+	var e error
+	var src string
+	var t xgo.Target
+	var targets []xgo.Target
+
+	if len(flags.targets) > 0 {
+		targets, e = parseTargets(flags.targets)
+		return targets, "from --targets", e
+	}
+
+	if t, src, e = resolveTarget(); e != nil {
+		return nil, "", e
+	}
+
+	return []xgo.Target{t}, src, nil
+}
+
+// Add -exec to go test, if the target needs a runner (e.g. qemu or
+// wine). The error wraps xgo.ErrNoRunner if no runner was found.
+func runnerArgs(
+	x *xgo.Compiler,
+	t xgo.Target,
+	env map[string]string,
+	args []string,
+) ([]string, error) {
+	if args[0] != "test" {
+		return args, nil
 	}
+
+	//nolint:wrapcheck // Nothing to add
+	return x.RunnerArgs(t, env, args)
+}
+
+// Add the default flags from the selected profile, and the flags
+// needed for reproducible builds, if requested
+func sanityCheck(args []string) []string {
+	var p xgo.Profile
+
+	// Already validated
+	p, _ = config.Profile(flags.profile)
+	args = xgo.BuildArgsSanityCheck(args, p, !flags.noMerge)
+
+	if flags.repro {
+		// Always merged, as they're required
+		args = xgo.BuildArgsSanityCheck(args, reproducible, true)
+	}
+
+	return args
 }
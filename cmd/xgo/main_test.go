@@ -0,0 +1,93 @@
+//nolint:godoclint // These are tests
+package main
+
+import (
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestResolveTargets(t *testing.T) {
+	var e error
+	var src string
+	var targets []xgo.Target
+
+	// Not parallel, as the cli flags are global
+	t.Cleanup(func() { flags.targets = nil })
+
+	// A single --targets entry must not fall back to --target
+	flags.targets = []string{"linux/arm64"}
+
+	targets, src, e = resolveTargets()
+	assert.NoError(t, e)
+	assert.Equal(t, "from --targets", src)
+	assert.Equal(
+		t,
+		[]xgo.Target{{OS: "linux", Arch: "arm64"}},
+		targets,
+	)
+
+	flags.targets = []string{"linux/arm/7,softfloat", "windows/amd64"}
+
+	targets, _, e = resolveTargets()
+	assert.NoError(t, e)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "linux/arm/7,softfloat", targets[0].String())
+
+	flags.targets = []string{"linux"}
+
+	_, _, e = resolveTargets()
+	assert.Error(t, e)
+}
+
+func TestSplitReverseArgs(t *testing.T) {
+	t.Parallel()
+
+	var args []string
+	var files []string
+
+	args, files = splitReverseArgs([]string{"-tags", "a", "."})
+	assert.Equal(t, []string{"-tags", "a", "."}, args)
+	assert.Empty(t, files)
+
+	args, files = splitReverseArgs(
+		[]string{"-tags=a", "./cmd/app", "a.txt", "b.txt"},
+	)
+	assert.Equal(t, []string{"-tags=a", "./cmd/app"}, args)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, files)
+}
+
+func TestTargetArgs(t *testing.T) {
+	var host xgo.Target = xgo.HostTarget()
+
+	// Not parallel, as the cli flags are global
+	t.Cleanup(func() { flags.stamp = false })
+
+	flags.stamp = true
+
+	// Commands that don't link must not read git
+	assert.Equal(
+		t,
+		[]string{"mod", "tidy"},
+		targetArgs([]string{"mod", "tidy"}, host, ""),
+	)
+	assert.False(t, vcs.read)
+}
+
+func TestUniversalTargets(t *testing.T) {
+	t.Parallel()
+
+	var targets []xgo.Target = []xgo.Target{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "darwin", Arch: "amd64"},
+	}
+
+	assert.Equal(
+		t,
+		[]xgo.Target{{OS: "linux", Arch: "amd64"}},
+		universalTargets(targets),
+	)
+	assert.Empty(t, universalTargets(nil))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mjwhitta/log"
+	"github.com/mjwhitta/xgo"
+)
+
+// Return the result for the target, including the inputs of
+// universal builds, or the only result, if no target was provided
+func findResult(
+	results []*xgo.BuildResult,
+	target string,
+) *xgo.BuildResult {
+	var all []*xgo.BuildResult
+	var names []string
+
+	for _, r := range results {
+		if len(r.Inputs) > 0 {
+			all = append(all, r.Inputs...)
+		} else {
+			all = append(all, r)
+		}
+	}
+
+	for _, r := range all {
+		if r.Target.String() == target {
+			return r
+		}
+
+		names = append(names, r.Target.String())
+	}
+
+	switch {
+	case len(all) == 0:
+		log.ErrX(InvalidArgument, "report has no results")
+	case target != "":
+		log.ErrXf(
+			InvalidOption,
+			"report has no results for %s (available: %s)",
+			target,
+			strings.Join(names, ", "),
+		)
+	case len(all) > 1:
+		log.ErrXf(
+			MissingOption,
+			"reverse requires --target (available: %s)",
+			strings.Join(names, ", "),
+		)
+	}
+
+	return all[0]
+}
+
+// De-obfuscate garble stack traces, using the garble options and
+// build flags from a build report, or the provided seed
+func reverse(
+	ctx context.Context,
+	x *xgo.Compiler,
+	t xgo.Target,
+	args []string,
+) {
+	var e error
+	var files []string
+	var fs *flag.FlagSet
+	var r *xgo.BuildResult
+	var report string
+	var rpt *xgo.Report
+	var seed string
+	var target string = flags.target
+
+	fs = flag.NewFlagSet("reverse", flag.ContinueOnError)
+	fs.StringVar(&report, "report", "", "")
+	fs.StringVar(&seed, "seed", "", "")
+	fs.StringVar(&target, "target", target, "")
+	fs.SetOutput(io.Discard)
+
+	if e = fs.Parse(args); e != nil {
+		log.ErrX(InvalidOption, e.Error())
+	}
+
+	files = fs.Args()
+
+	if report != "" {
+		if target != "" {
+			if t, e = xgo.ParseTarget(target); e != nil {
+				log.ErrX(InvalidOption, e.Error())
+			}
+
+			// Normalized (e.g. "linux/amd64/3" is "linux/amd64/v3")
+			target = t.String()
+		}
+
+		if rpt, e = xgo.ReadReport(report); e != nil {
+			panic(e)
+		}
+
+		r = findResult(rpt.Results, target)
+	} else {
+		if seed == "" {
+			log.ErrX(
+				MissingOption,
+				"reverse requires --report or --seed",
+			)
+		}
+
+		if target != "" {
+			if t, e = xgo.ParseTarget(target); e != nil {
+				log.ErrX(InvalidOption, e.Error())
+			}
+		}
+
+		// The build flags and package are provided before any files
+		args, files = splitReverseArgs(files)
+		r = &xgo.BuildResult{
+			Command: slices.Concat([]string{"garble", "build"}, args),
+			Garble:  &x.GarbleOptions,
+			Target:  t,
+		}
+	}
+
+	if (seed != "") && (r.Garble != nil) {
+		r.Garble.Seed = seed
+	}
+
+	if e = x.ReverseContext(ctx, r, files...); e != nil {
+		panic(canceled(ctx, e))
+	}
+}
+
+// Split the args for reverse --seed into the build flags and package,
+// and any files, the same as garble reverse
+func splitReverseArgs(args []string) ([]string, []string) {
+	var a xgo.GoArgs = xgo.ParseGoArgs(
+		slices.Concat([]string{"build"}, args),
+		"",
+	)
+	var n int
+
+	// Everything after the package is a file
+	if len(a.Packages) > 1 {
+		n = len(args) - len(a.Packages) + 1
+	} else {
+		n = len(args)
+	}
+
+	return args[:n], args[n:]
+}
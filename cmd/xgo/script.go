@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/mjwhitta/cli"
+	"github.com/mjwhitta/log"
+	"github.com/mjwhitta/xgo"
+)
+
+// A single command, for a single target, in a build script
+type step struct {
+	cmd    string   // Env vars and command, from Debug
+	output string   // Artifact to checksum, if any
+	remove []string // Intermediate files to remove afterward
+	target xgo.Target
+}
+
+// Return the bash script for the provided steps
+func bashScript(steps []step) string {
+	var lines []string = []string{
+		"#!/usr/bin/env bash",
+		"# Generated by xgo " + xgo.Version + ", run it from the",
+		"# directory xgo was run from",
+		"",
+		"set -euo pipefail",
+	}
+	var name string
+	var names []string
+	var prev xgo.Target
+
+	for i, s := range steps {
+		if (i == 0) || (s.target != prev) {
+			lines = append(lines, "", "# "+s.target.String())
+		}
+
+		prev = s.target
+		lines = append(lines, s.cmd)
+
+		if len(s.remove) > 0 {
+			lines = append(lines, "rm -f "+quoteAll("sh", s.remove))
+		}
+	}
+
+	if names = checksumNames(steps); len(names) == 0 {
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	name = checksumAlgorithm(flags.checksums) + "sum"
+	if flags.tag {
+		name += " --tag"
+	}
+
+	name += " " + quoteAll("sh", names)
+	name += " >" + xgo.Quote("sh", filepath.Base(flags.checksums))
+
+	if dir := filepath.Dir(flags.checksums); dir != "." {
+		name = "(cd " + xgo.Quote("sh", dir) + " && " + name + ")"
+	}
+
+	lines = append(lines, "", "# Checksums", name)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Return the artifact paths, relative to the checksum file
+func checksumNames(steps []step) []string {
+	var dir string = filepath.Dir(flags.checksums)
+	var e error
+	var name string
+	var names []string
+
+	if flags.checksums == "" {
+		return nil
+	}
+
+	for _, s := range steps {
+		if s.output == "" {
+			continue
+		}
+
+		name, e = filepath.Rel(dir, s.output)
+		if e != nil {
+			panic(fmt.Errorf("failed to resolve %s: %w", s.output, e))
+		}
+
+		names = append(names, filepath.ToSlash(name))
+	}
+
+	if len(names) == 0 {
+		panic(errors.New("no artifacts to checksum"))
+	}
+
+	return names
+}
+
+// Return the PowerShell script for the provided steps
+func powerShellScript(steps []step) string {
+	var algo string
+	var lines []string = []string{
+		"# Generated by xgo " + xgo.Version + ", run it from the",
+		"# directory xgo was run from",
+		"",
+		"$ErrorActionPreference = 'Stop'",
+		"",
+		"# Env vars persist, so restore them after each command",
+		"$xgoEnv = @{}",
+		"Get-ChildItem Env: | ForEach-Object {",
+		"    $xgoEnv[$_.Name] = $_.Value",
+		"}",
+		"",
+		"function Reset-XgoEnv {",
+		"    Get-ChildItem Env: | Where-Object {",
+		"        !$xgoEnv.ContainsKey($_.Name)",
+		"    } | Remove-Item",
+		"    $xgoEnv.GetEnumerator() | ForEach-Object {",
+		"        Set-Item -LiteralPath \"Env:$($_.Key)\" $_.Value",
+		"    }",
+		"}",
+	}
+	var names []string
+	var prev xgo.Target
+	var sum string
+
+	for i, s := range steps {
+		if (i == 0) || (s.target != prev) {
+			lines = append(lines, "", "# "+s.target.String())
+		}
+
+		prev = s.target
+		lines = append(
+			lines,
+			s.cmd,
+			"if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }",
+			"Reset-XgoEnv",
+		)
+
+		if len(s.remove) > 0 {
+			lines = append(
+				lines,
+				"Remove-Item -LiteralPath "+strings.Join(
+					quoteEach("powershell", s.remove),
+					", ",
+				),
+			)
+		}
+	}
+
+	if names = checksumNames(steps); len(names) == 0 {
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	algo = strings.ToUpper(checksumAlgorithm(flags.checksums))
+
+	sum = "\"$hash  $f`n\""
+	if flags.tag {
+		sum = "\"" + algo + " ($f) = $hash`n\""
+	}
+
+	lines = append(
+		lines,
+		"",
+		"# Checksums",
+		"Push-Location -LiteralPath "+xgo.Quote(
+			"powershell",
+			filepath.Dir(flags.checksums),
+		),
+		"$sums = foreach ($f in @(",
+		"    "+strings.Join(psStrings(names), ",\n    "),
+		")) {",
+		"    $hash = (",
+		"        Get-FileHash -Algorithm "+algo+" -LiteralPath $f",
+		"    ).Hash.ToLower()",
+		"    "+sum,
+		"}",
+		"Set-Content -NoNewline -LiteralPath "+xgo.Quote(
+			"powershell",
+			filepath.Base(flags.checksums),
+		)+" -Value (-join $sums)",
+		"Pop-Location",
+	)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Quote each value as a PowerShell string, as unquoted array elements
+// would be run as commands
+func psStrings(values []string) []string {
+	var quoted []string = quoteEach("powershell", values)
+
+	for i, q := range quoted {
+		if !strings.HasPrefix(q, "'") {
+			quoted[i] = "'" + q + "'"
+		}
+	}
+
+	return quoted
+}
+
+// Quote each arg for the provided shell, then join them with spaces
+func quoteAll(shell string, args []string) string {
+	return strings.Join(quoteEach(shell, args), " ")
+}
+
+// Quote each arg for the provided shell
+func quoteEach(shell string, args []string) []string {
+	var quoted []string
+
+	for _, arg := range args {
+		quoted = append(quoted, xgo.Quote(shell, arg))
+	}
+
+	return quoted
+}
+
+// Write a standalone script that runs the same builds xgo would, for
+// builders without xgo
+func script(
+	ctx context.Context,
+	x *xgo.Compiler,
+	targets []xgo.Target,
+	args []string,
+) {
+	var e error
+	var fs *flag.FlagSet
+	var lists cli.StringList
+	var shell string = "bash"
+	var steps []step
+
+	if runtime.GOOS == "windows" {
+		shell = "powershell"
+	}
+
+	fs = flag.NewFlagSet("script", flag.ContinueOnError)
+	fs.StringVar(&shell, "shell", shell, "")
+	fs.Var(&lists, "targets", "")
+	fs.SetOutput(io.Discard)
+
+	if e = fs.Parse(args); e != nil {
+		log.ErrX(InvalidOption, e.Error())
+	}
+
+	switch {
+	case flags.archive != "":
+		log.ErrX(InvalidOption, "script doesn't support --archive")
+	case flags.report != "":
+		log.ErrX(InvalidOption, "script doesn't support --report")
+	}
+
+	if len(lists) > 0 {
+		if targets, e = parseTargets(lists); e != nil {
+			log.ErrX(InvalidOption, e.Error())
+		}
+	} else if flags.universal && (len(flags.targets) == 0) {
+		targets = nil
+	}
+
+	if args = fs.Args(); len(args) == 0 {
+		args = []string{"build"}
+	}
+
+	args = sanityCheck(args)
+
+	// Commands are printed, rather than run
+	x.Debug = true
+	x.Stderr = nil
+	x.Stdin = nil
+	x.Stdout = nil
+	x.Trace = nil
+
+	switch shell {
+	case "bash", "sh":
+		x.Shell = "sh"
+		steps = scriptSteps(ctx, x, targets, args)
+		fmt.Print(bashScript(steps))
+	case "powershell", "pwsh":
+		x.Shell = "powershell"
+		steps = scriptSteps(ctx, x, targets, args)
+		fmt.Print(powerShellScript(steps))
+	default:
+		log.ErrXf(InvalidOption, "unsupported script shell %s", shell)
+	}
+}
+
+// Return the steps to build each target, the same as build
+func scriptSteps(
+	ctx context.Context,
+	x *xgo.Compiler,
+	targets []xgo.Target,
+	args []string,
+) []step {
+	var e error
+	var env map[string]string
+	var inputs []string
+	var out string
+	var r *xgo.BuildResult
+	var s step
+	var steps []step
+	var tmp []string
+	var total int = len(targets)
+	var universal xgo.Target = xgo.Target{
+		OS:   "darwin",
+		Arch: "universal",
+	}
+
+	// Darwin targets are replaced by a single universal build
+	if flags.universal {
+		targets = universalTargets(targets)
+		total = len(targets) + 1
+	}
+
+	// Each target needs its own output file
+	if total > 1 {
+		out = outputName(ctx, x, targets, args)
+	}
+
+	for _, t := range targets {
+		if env, e = x.SetupTargetEnvContext(ctx, t); e != nil {
+			panic(canceled(ctx, e))
+		}
+
+		// Tests that can't run would fail the script
+		tmp = targetArgs(args, t, out)
+		if tmp, e = x.RunnerArgs(t, env, tmp); e != nil {
+			panic(e)
+		}
+
+		if r, e = x.BuildContext(ctx, t, tmp...); e != nil {
+			panic(canceled(ctx, e))
+		}
+
+		s = step{cmd: r.Stdout, target: t}
+
+		if flags.checksums != "" {
+			if s.output, e = x.Output(env, tmp...); e != nil {
+				panic(e)
+			}
+		}
+
+		steps = append(steps, s)
+	}
+
+	if !flags.universal {
+		return steps
+	}
+
+	tmp = targetArgs(args, universal, "")
+	if r, e = x.BuildUniversalContext(ctx, tmp...); e != nil {
+		panic(canceled(ctx, e))
+	}
+
+	out = outputName(ctx, x, nil, tmp)
+
+	// Without lipo, the merge is only a note, so keep the thin
+	// binaries
+	_, e = xgo.FindLipo()
+
+	for _, input := range r.Inputs {
+		inputs = append(inputs, input.Target.Output(out))
+
+		s = step{cmd: input.Stdout, target: universal}
+		if (e != nil) && (flags.checksums != "") {
+			s.output = input.Target.Output(out)
+		}
+
+		steps = append(steps, s)
+	}
+
+	// The lipo command follows the thin builds
+	_, r.Stdout, _ = strings.Cut(
+		r.Stdout,
+		r.Inputs[0].Stdout+"\n"+r.Inputs[1].Stdout+"\n",
+	)
+
+	if e != nil {
+		log.Warn("lipo not found, so the script won't merge binaries")
+		return append(steps, step{cmd: r.Stdout, target: universal})
+	}
+
+	return append(
+		steps,
+		step{
+			cmd:    r.Stdout,
+			output: universal.Output(out),
+			remove: inputs,
+			target: universal,
+		},
+	)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/mjwhitta/xgo"
+)
+
+// Git info, read once, as needed
+var vcs struct {
+	e    error
+	info *xgo.GitInfo
+	read bool
+}
+
+// Expand a template for the target, using the git info, if available
+func expand(tmpl string, t xgo.Target) string {
+	var e error
+	var out string
+
+	readGitInfo()
+
+	if out, e = xgo.ExpandTemplate(tmpl, t, vcs.info); e != nil {
+		// Likely because the git info is missing
+		if vcs.e != nil {
+			panic(vcs.e)
+		}
+
+		panic(e)
+	}
+
+	return out
+}
+
+// Read the git info, if not already read
+func readGitInfo() {
+	if !vcs.read {
+		vcs.info, vcs.e = xgo.ReadGitInfo(context.Background(), "")
+		vcs.read = true
+	}
+}
+
+// Return the -X vars to stamp for the target, if enabled (or if any
+// vars were provided)
+func stampVars(t xgo.Target) map[string]string {
+	var vars map[string]string = map[string]string{}
+
+	if !flags.stamp && (len(flags.stampVars) == 0) {
+		return nil
+	}
+
+	for k, v := range config.Stamp {
+		vars[k] = v
+	}
+
+	for _, kv := range flags.stampVars {
+		// Already validated
+		k, v, _ := strings.Cut(kv, "=")
+		vars[k] = v
+	}
+
+	if len(vars) == 0 {
+		vars = map[string]string{
+			"main.commit":  "{{.Commit}}",
+			"main.date":    "{{.Date}}",
+			"main.version": "{{.Version}}",
+		}
+	}
+
+	for k, v := range vars {
+		vars[k] = expand(v, t)
+	}
+
+	return vars
+}
+
+// Return the args for a single target, with its own output file (if
+// out isn't empty, or -o is a template) and any stamped vars
+func targetArgs(args []string, t xgo.Target, out string) []string {
+	var o string
+
+	o, _ = xgo.ParseGoArgs(args, "").Flag("o")
+
+	switch {
+	case !strings.Contains(o, "{{"):
+		if out != "" {
+			args = xgo.SetOutput(args, t.Output(out))
+		}
+	case (out != "") && !strings.Contains(filepath.Base(out), "{{"):
+		// Only the directory is a template, so each target still
+		// needs its own output file
+		args = xgo.SetOutput(args, t.Output(expand(out, t)))
+	default:
+		args = xgo.SetOutput(args, expand(o, t))
+	}
+
+	// Only commands that link are stamped, so git is only read then
+	switch args[0] {
+	case "build", "install", "run", "test":
+		return xgo.StampArgs(args, stampVars(t))
+	default:
+		return args
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mjwhitta/cli"
+	"github.com/mjwhitta/log"
+	"github.com/mjwhitta/xgo"
+)
+
+// Pick the checksum algorithm based on the filename (e.g. SHA512SUMS)
+func checksumAlgorithm(fn string) string {
+	if strings.Contains(strings.ToLower(fn), "512") {
+		return "sha512"
+	}
+
+	return "sha256"
+}
+
+// Verify every entry in the provided checksum files
+func verify(args []string) {
+	var e error
+	var failed int
+	var sums []xgo.Checksum
+
+	if len(args) == 0 {
+		cli.Usage(MissingArgument)
+	}
+
+	for _, fn := range args {
+		if sums, e = xgo.ReadChecksums(fn); e != nil {
+			panic(e)
+		}
+
+		for _, sum := range sums {
+			if e = sum.Verify(); e != nil {
+				fmt.Printf("%s: FAILED\n", sum.Path)
+				failed++
+
+				continue
+			}
+
+			fmt.Printf("%s: OK\n", sum.Path)
+		}
+	}
+
+	if failed > 0 {
+		panic(fmt.Errorf("%d checksums did NOT match", failed))
+	}
+}
+
+// Write a checksum file for every artifact produced
+func writeChecksums(results []*xgo.BuildResult) {
+	var artifacts []*xgo.Artifact
+
+	for _, r := range results {
+		if r.Artifact != nil {
+			artifacts = append(artifacts, r.Artifact)
+		}
+
+		if r.Archive != nil {
+			artifacts = append(artifacts, r.Archive)
+		}
+	}
+
+	if len(artifacts) == 0 {
+		log.Warn("No artifacts to checksum")
+	}
+
+	if e := xgo.WriteChecksums(
+		flags.checksums,
+		checksumAlgorithm(flags.checksums),
+		flags.tag,
+		artifacts...,
+	); e != nil {
+		panic(e)
+	}
+}
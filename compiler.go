@@ -1,99 +1,288 @@
 package xgo
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
-	"runtime"
+	"path"
 	"slices"
 	"strings"
+	"time"
 )
 
 // Compiler is a struct containing relevant data for cross-compiling
 // Go.
 type Compiler struct {
-	Debug  bool
+	// Debug will return (or write) the go command, without running
+	// it.
+	Debug bool
+
+	// DebugEnv is the env vars (or globs) to show with Debug and
+	// Trace. If empty, the env vars that differ from Go's defaults,
+	// or that xgo changed, are shown.
+	DebugEnv []string
+
+	// Garble will run build, install, run, and test with garble, and
+	// other go commands with go (see GarbleSupports).
 	Garble bool
-	Zig    bool
+
+	// GarbleOptions are only used if Garble is true. Build will
+	// choose (and report) the seed, if it's random.
+	GarbleOptions GarbleOptions
+
+	// Reproducible will only keep the host env vars needed to run the
+	// toolchains and fetch modules (paths like PATH, HOME, GOPATH,
+	// GOCACHE, and temp dirs, the GOPROXY family, GOFLAGS, proxy and
+	// TLS cert vars, SSH_AUTH_SOCK, and GIT_*), pin
+	// SOURCE_DATE_EPOCH, and drop garble's random seed.
+	Reproducible bool
+
+	// Runners are the go test -exec commands, by target, to use
+	// instead of the defaults (see Runner).
+	Runners map[string]string
+
+	// Shell for Debug and Trace output: sh, fish, powershell, or cmd.
+	// Defaults to powershell on Windows and sh everywhere else.
+	Shell string
+
+	// Stderr and Stdout, if set, are where Build and Stream write the
+	// go command's output as it runs, rather than buffering it.
+	Stderr io.Writer
+	Stdout io.Writer
+
+	Stdin io.Reader // Only used by Attach
+
+	// Trace will write the go command, then run it and write how long
+	// it took.
+	Trace io.Writer
+
+	// Verify will make Build build each artifact twice, with
+	// separate, empty GOCACHEs, and fail if they differ.
+	Verify bool
+
+	// Zig will use zig cc and zig c++ as the cross-compilers for CGO,
+	// rather than the host's cross-compilers.
+	Zig bool
+}
+
+// Attach will run the go command with the Compiler's Stdin, Stdout,
+// and Stderr (or os.Stdin, os.Stdout, and os.Stderr, if unset)
+// attached directly, so that interactive programs (e.g. "go run")
+// behave the same as they would with go.
+func (x *Compiler) Attach(
+	env map[string]string,
+	args ...string,
+) error {
+	return x.AttachContext(context.Background(), env, args...)
+}
+
+// AttachContext is the same as Attach, but the go command and any
+// processes it started will be killed if the context is canceled. If
+// stdin is a terminal, the go command's process group is moved to the
+// foreground while it runs, so that it can read from stdin.
+func (x *Compiler) AttachContext(
+	ctx context.Context,
+	env map[string]string,
+	args ...string,
+) error {
+	var stderr io.Writer = x.Stderr
+	var stdin io.Reader = x.Stdin
+	var stdout io.Writer = x.Stdout
+
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+
+	_, e := x.run(ctx, env, args, stdin, stdout, stderr)
+
+	return e
+}
+
+func (x *Compiler) command(args []string) (string, []string) {
+	var proc string = "go"
+
+	if x.garbled(args) {
+		proc = "garble"
+
+		// A random seed can't reverse anything
+		args = slices.Concat(
+			x.GarbleOptions.args(
+				!x.Reproducible && (args[0] != "reverse"),
+			),
+			removeFlags(args, garbleIncompatible...),
+		)
+	}
+
+	return proc, args
+}
+
+func (x *Compiler) debugEnv(
+	ctx context.Context,
+	env map[string]string,
+) ([]string, error) {
+	var base map[string]string
+	var changed map[string]string = map[string]string{}
+	var e error
+	var keep []string
+	var stdout string
+	var target []string
+
+	// User-provided list of names (or globs)
+	if len(x.DebugEnv) > 0 {
+		for k := range env {
+			for _, pattern := range x.DebugEnv {
+				if ok, _ := path.Match(pattern, k); ok {
+					keep = append(keep, k)
+					break
+				}
+			}
+		}
+
+		slices.Sort(keep)
+
+		return keep, nil
+	}
+
+	// Otherwise, the target, anything that differs from Go's
+	// defaults for the target (i.e. anything xgo changed), any Go
+	// vars the user changed, and any pkg-config vars (for cgo)
+	target = []string{"GOARCH", "GOOS", TargetFromEnv(env).EnvVar()}
+	base = osEnv()
+
+	for _, k := range target {
+		if v, ok := env[k]; ok {
+			base[k] = v
+			changed[k] = v
+		}
+	}
+
+	if base, e = x.goEnv(ctx, base); e != nil {
+		return nil, e
+	}
+
+	stdout, e = x.queryEnv(ctx, osEnv(), "-changed", "-json")
+	if e != nil {
+		return nil, e
+	}
+
+	// Choosing to trust "go env --json" output
+	_ = json.Unmarshal([]byte(stdout), &changed)
+
+	maps.Copy(changed, ChangedEnv(env, base))
+
+	for k := range env {
+		if _, ok := changed[k]; ok {
+			keep = append(keep, k)
+		} else if strings.HasPrefix(k, "PKG_CONFIG_") {
+			keep = append(keep, k)
+		}
+	}
+
+	slices.Sort(keep)
+
+	return keep, nil
 }
 
 func (x *Compiler) debugRun(
+	ctx context.Context,
+	env map[string]string,
 	proc string,
-	enviro []string,
 	args []string,
-) string {
-	var keep []string = []string{
-		"CC=",
-		"CGO_ENABLED=",
-		"CXX=",
-		"GOARCH=",
-		"GOOS=",
-	}
-	var relevant []string
-	var tmp []string
+) (string, error) {
+	var e error
+	var keep []string
+	var lines []string
+	var shell string = defaultShell(x.Shell)
+	var tmp []string = []string{proc}
 
-	for _, v := range enviro {
-		for i := range keep {
-			if strings.HasPrefix(v, keep[i]) {
-				switch runtime.GOOS {
-				case "windows":
-					relevant = append(relevant, "$env:"+quote(v)+";")
-				default:
-					relevant = append(relevant, quote(v)+" \\")
-				}
+	if e = checkShell(shell, args...); e != nil {
+		return "", e
+	}
 
-				break
-			}
+	if keep, e = x.debugEnv(ctx, env); e != nil {
+		return "", e
+	}
+
+	for _, k := range keep {
+		if e = checkShell(shell, env[k]); e != nil {
+			return "", e
+		}
+
+		switch shell {
+		case "fish", "sh":
+			// Only set for the go command
+			lines = append(
+				lines,
+				k+"="+quoteArg(shell, env[k])+" \\",
+			)
+		default:
+			lines = append(lines, quoteEnv(shell, k, env[k]))
 		}
 	}
 
 	for i := range args {
-		tmp = append(tmp, quote(args[i]))
+		tmp = append(tmp, quoteArg(shell, args[i]))
 	}
 
-	return fmt.Sprintf(
-		"%s\n%s %s",
-		strings.Join(relevant, "\n"),
-		proc,
-		strings.Join(tmp, " "),
-	)
+	lines = append(lines, strings.Join(tmp, " "))
+
+	return strings.Join(lines, "\n"), nil
 }
 
 func (x *Compiler) defaultEnv(
-	goos string,
-	goarch string,
+	ctx context.Context,
+	t Target,
 	cgo string,
 ) (map[string]string, error) {
-	var debug bool
-	var e error
-	var env map[string]string = map[string]string{}
-	var stdout string
-	var tmp map[string]string
+	var env map[string]string = osEnv()
 
-	// Get default env
-	for _, line := range os.Environ() {
-		if k, v, ok := strings.Cut(line, "="); ok {
-			v = strings.TrimPrefix(v, "'")
-			v = strings.TrimSuffix(v, "'")
-			env[k] = v
-		}
+	// Clear host-specific env vars
+	if x.Reproducible {
+		env = reproducibleEnv(env)
 	}
 
 	// Enable CGO if cross-compiling
 	env["CGO_ENABLED"] = cgo
 
 	// Modify env for target GOOS/GOARCH
-	env["GOARCH"] = goarch
-	env["GOOS"] = goos
+	env["GOARCH"] = t.Arch
+	env["GOOS"] = t.OS
+
+	// Clear host variants, so only the target's variant applies
+	for _, v := range variants {
+		delete(env, v.env)
+	}
 
-	debug = x.Debug
-	x.Debug = false
-	defer func() { x.Debug = debug }()
+	// Modify env for target variant, if provided
+	if (t.Variant != "") && (t.EnvVar() != "") {
+		env[t.EnvVar()] = t.Variant
+	}
 
 	// Get default Go env vars for target GOOS/GOARCH
-	if stdout, e = x.Run(env, "env", "--json"); e != nil {
+	return x.goEnv(ctx, env)
+}
+
+func (x *Compiler) goEnv(
+	ctx context.Context,
+	env map[string]string,
+) (map[string]string, error) {
+	var e error
+	var stdout string
+	var tmp map[string]string
+
+	if stdout, e = x.queryEnv(ctx, env, "--json"); e != nil {
 		return nil, e
 	}
 
@@ -110,58 +299,189 @@ func (x *Compiler) defaultEnv(
 	return env, nil
 }
 
-// Run will run the go command.
-func (x *Compiler) Run(
+// Run go without debugging or tracing, for internal queries
+func (x *Compiler) query(
+	ctx context.Context,
+	env map[string]string,
+	args ...string,
+) (string, error) {
+	var tmp Compiler = *x
+
+	tmp.Debug = false
+	tmp.Trace = nil
+
+	return tmp.RunContext(ctx, env, args...)
+}
+
+// Run go env for internal queries, caching the output by env and
+// args, as Debug and Trace would otherwise run it for every command
+func (x *Compiler) queryEnv(
+	ctx context.Context,
 	env map[string]string,
 	args ...string,
 ) (string, error) {
-	var b []byte
-	var cmd *exec.Cmd
 	var e error
-	var enviro []string
-	var proc string = "go"
+	var key string
+	var stdout string
+	var tmp []string
 
-	if x.Garble && (len(args) > 0) && (args[0] == "build") {
-		proc = "garble"
+	for k, v := range env {
+		tmp = append(tmp, k+"="+v)
+	}
 
-		args = append(
-			[]string{"--literals", "--seed=random", "--tiny"},
-			args...,
-		)
+	// Fail as the go command would have, even if cached
+	if e = ctx.Err(); e != nil {
+		return "", fmt.Errorf("go env: %w", e)
+	}
 
-		for i, arg := range args {
-			if strings.HasSuffix(arg, "-trimpath") {
-				args = append(args[:i], args[i+1:]...)
-				break
-			}
-		}
+	slices.Sort(tmp)
+	key = strings.Join(append(tmp, args...), "\x00")
+
+	//nolint:forcetypeassert // Only strings are stored
+	if v, ok := goEnvCache.Load(key); ok {
+		return v.(string), nil
 	}
 
+	args = append([]string{"env"}, args...)
+	if stdout, e = x.query(ctx, env, args...); e != nil {
+		return "", e
+	}
+
+	goEnvCache.Store(key, stdout)
+
+	return stdout, nil
+}
+
+func (x *Compiler) run(
+	ctx context.Context,
+	env map[string]string,
+	args []string,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+) ([]byte, error) {
+	var b []byte
+	var cmd *exec.Cmd
+	var e error
+	var enviro []string
+	var errb tailWriter
+	var proc string
+	var restore func() error = func() error { return nil }
+	var script string
+	var start time.Time
+
+	proc, args = x.command(args)
+
 	for k, v := range env {
 		enviro = append(enviro, k+"="+v)
 	}
 
 	slices.Sort(enviro)
 
+	if x.Debug || (x.Trace != nil) {
+		script, e = x.debugRun(ctx, env, proc, args)
+		if e != nil {
+			return nil, e
+		}
+	}
+
 	if x.Debug {
-		return x.debugRun(proc, enviro, args), nil
+		if stdout != nil {
+			_, e := fmt.Fprintln(stdout, script)
+			return nil, e //nolint:wrapcheck // Nothing to add
+		}
+
+		return []byte(script), nil
 	}
 
 	//nolint:gosec // G204 - That's kinda the point here
-	cmd = exec.Command(proc, args...)
+	cmd = exec.CommandContext(ctx, proc, args...)
 	cmd.Env = enviro
 
-	if b, e = cmd.Output(); e != nil {
-		switch e := e.(type) {
-		case *exec.ExitError:
-			if b = bytes.TrimSpace(e.Stderr); len(b) > 0 {
-				return "", fmt.Errorf("%s", b)
-			}
-		default:
-			return "", e
+	// Capture stderr for errors, even when streaming, but only keep
+	// the end of streamed stderr, as it was already shown
+	cmd.Stderr = &errb
+	if stderr != nil {
+		errb.max = maxStderr
+		cmd.Stderr = io.MultiWriter(stderr, &errb)
+	}
+
+	// Kill the whole process group (compile, link, cgo, go run's
+	// child, etc.) on cancellation, not just the go command
+	if stdin != nil {
+		// Attached directly, so the go command sees the same files
+		// (e.g. a terminal) that xgo was given
+		cmd.Stdin = stdin
+		cmd.Stderr = stderr
+
+		restore = setForegroundProcessGroup(cmd, stdin)
+	} else {
+		setProcessGroup(cmd)
+	}
+
+	if x.Trace != nil {
+		_, _ = fmt.Fprintln(x.Trace, script)
+	}
+
+	start = time.Now()
+
+	if stdout != nil {
+		cmd.Stdout = stdout
+		e = cmd.Run()
+	} else {
+		b, e = cmd.Output()
+	}
+
+	// Otherwise xgo is left in the background
+	if re := restore(); re != nil {
+		_, _ = fmt.Fprintln(stderr, "failed to restore terminal:", re)
+	}
+
+	if x.Trace != nil {
+		x.trace(time.Since(start), e)
+	}
+
+	if (e != nil) && (ctx.Err() != nil) {
+		return b, fmt.Errorf("%s: %w", proc, ctx.Err())
+	}
+
+	if xe, ok := e.(*exec.ExitError); ok {
+		return b, &ExitError{
+			Code:     xe.ExitCode(),
+			Command:  append([]string{proc}, args...),
+			Stderr:   strings.TrimSpace(errb.String()),
+			Streamed: stderr != nil,
+			Target:   TargetFromEnv(env),
+			err:      xe,
 		}
 	}
 
+	//nolint:wrapcheck // Failed to start, nothing to add
+	return b, e
+}
+
+// Run will run the go command.
+func (x *Compiler) Run(
+	env map[string]string,
+	args ...string,
+) (string, error) {
+	return x.RunContext(context.Background(), env, args...)
+}
+
+// RunContext will run the go command. If the context is canceled, the
+// go command and any processes it started will be killed.
+func (x *Compiler) RunContext(
+	ctx context.Context,
+	env map[string]string,
+	args ...string,
+) (string, error) {
+	var b []byte
+	var e error
+
+	if b, e = x.run(ctx, env, args, nil, nil, nil); e != nil {
+		return "", e
+	}
+
 	return strings.TrimSuffix(string(b), "\n"), nil
 }
 
@@ -174,6 +494,36 @@ func (x *Compiler) Run(
 func (x *Compiler) SetupEnv(
 	goos string,
 	goarch string,
+) (map[string]string, error) {
+	return x.SetupTargetEnv(Target{OS: goos, Arch: goarch})
+}
+
+// SetupEnvContext is the same as SetupEnv, but uses the provided
+// context when querying the go command.
+func (x *Compiler) SetupEnvContext(
+	ctx context.Context,
+	goos string,
+	goarch string,
+) (map[string]string, error) {
+	return x.SetupTargetEnvContext(
+		ctx,
+		Target{OS: goos, Arch: goarch},
+	)
+}
+
+// SetupTargetEnv will set the same ENV vars as SetupEnv, as well as
+// the variant ENV var (GOARM, GOAMD64, etc.), if the Target has one.
+func (x *Compiler) SetupTargetEnv(
+	t Target,
+) (map[string]string, error) {
+	return x.SetupTargetEnvContext(context.Background(), t)
+}
+
+// SetupTargetEnvContext is the same as SetupTargetEnv, but uses the
+// provided context when querying the go command.
+func (x *Compiler) SetupTargetEnvContext(
+	ctx context.Context,
+	t Target,
 ) (map[string]string, error) {
 	var cc string
 	var cgo string = "0"
@@ -183,22 +533,23 @@ func (x *Compiler) SetupEnv(
 
 	// Get configured cross-compiler
 	if x.Zig {
-		cc, cxx = setupZig(goos, goarch)
+		cc, cxx = setupZig(t)
 	} else {
-		cc, cxx = setupCC(goos, goarch)
+		cc, cxx = setupCC(t)
 	}
 
-	// Enable CGO if we hare compiling for host OS
-	// Enable CGO if we have cross-compilers
-	if (runtime.GOOS == goos) || ((cc != "") && (cxx != "")) {
+	// Enable CGO if we have cross-compilers, or if the host compiler
+	// can build for the target, otherwise the host compiler would get
+	// flags for the wrong arch
+	if hostCC(t) || ((cc != "") && (cxx != "")) {
 		cgo = "1"
 	}
 
-	if env, e = x.defaultEnv(goos, goarch, cgo); e != nil {
+	if env, e = x.defaultEnv(ctx, t, cgo); e != nil {
 		return nil, e
 	}
 
-	if (runtime.GOOS == goos) || ((cc != "") && (cxx != "")) {
+	if cgo == "1" {
 		// Set cross-compilers in env
 		env["CC"] = cc
 		env["CGO_ENABLED"] = "1" // Redundant
@@ -207,3 +558,51 @@ func (x *Compiler) SetupEnv(
 
 	return env, nil
 }
+
+// Stream will run the go command, writing its output to the
+// Compiler's Stdout and Stderr (or os.Stdout and os.Stderr, if unset)
+// as it runs.
+func (x *Compiler) Stream(
+	env map[string]string,
+	args ...string,
+) error {
+	return x.StreamContext(context.Background(), env, args...)
+}
+
+// StreamContext is the same as Stream, but the go command and any
+// processes it started will be killed if the context is canceled.
+func (x *Compiler) StreamContext(
+	ctx context.Context,
+	env map[string]string,
+	args ...string,
+) error {
+	var stderr io.Writer = x.Stderr
+	var stdout io.Writer = x.Stdout
+
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+
+	_, e := x.run(ctx, env, args, nil, stdout, stderr)
+
+	return e
+}
+
+func (x *Compiler) trace(elapsed time.Duration, e error) {
+	var status string = "done"
+
+	if e != nil {
+		status = e.Error()
+	}
+
+	_, _ = fmt.Fprintf(
+		x.Trace,
+		"# %s in %s\n",
+		status,
+		elapsed.Round(time.Millisecond),
+	)
+}
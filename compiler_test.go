@@ -2,7 +2,10 @@
 package xgo_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,6 +13,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mjwhitta/xgo"
 	assert "github.com/stretchr/testify/require"
@@ -45,7 +49,7 @@ var tests = map[string][]compileTest{
 		{"ios", "amd64"},
 		{"ios", "arm64"},
 		{"js", "wasm"},
-		{"linux", "arm"},
+		{"linux", "arm"}, // unless gcc-arm-linux-gnueabihf
 		{"linux", "arm64"},
 		{"linux", "loong64"},
 		{"linux", "mips"},
@@ -132,14 +136,35 @@ var tests = map[string][]compileTest{
 	},
 }
 
-func bin(test compileTest, fn string, garble bool, zig bool) string {
+var variantTests = []xgo.Target{
+	{OS: "linux", Arch: "386", Variant: "softfloat"},
+	{OS: "linux", Arch: "amd64", Variant: "v3"},
+	{OS: "linux", Arch: "arm", Variant: "5"},
+	{OS: "linux", Arch: "arm", Variant: "7"},
+	{OS: "linux", Arch: "arm64", Variant: "v8.2,lse"},
+	{OS: "linux", Arch: "mips", Variant: "softfloat"},
+	{OS: "linux", Arch: "mipsle", Variant: "hardfloat"},
+	{OS: "linux", Arch: "mips64", Variant: "softfloat"},
+	{OS: "linux", Arch: "ppc64le", Variant: "power9"},
+	{OS: "linux", Arch: "riscv64", Variant: "rva22u64"},
+}
+
+func (c compileTest) target() xgo.Target {
+	return xgo.Target{OS: c.os, Arch: c.arch}
+}
+
+func bin(test xgo.Target, fn string, garble bool, zig bool) string {
 	var tmp string = fmt.Sprintf(
 		"%s.%s.%s",
 		strings.TrimSuffix(fn, filepath.Ext(fn)),
-		test.os,
-		test.arch,
+		test.OS,
+		test.Arch,
 	)
 
+	if test.Variant != "" {
+		tmp += "." + strings.ReplaceAll(test.Variant, ",", ".")
+	}
+
 	if garble {
 		tmp += ".garble"
 	}
@@ -148,7 +173,7 @@ func bin(test compileTest, fn string, garble bool, zig bool) string {
 		tmp += ".zig"
 	}
 
-	if test.os == "windows" {
+	if test.OS == "windows" {
 		tmp += ".exe"
 	}
 
@@ -157,7 +182,7 @@ func bin(test compileTest, fn string, garble bool, zig bool) string {
 
 func build(
 	t *testing.T,
-	test compileTest,
+	test xgo.Target,
 	file string,
 	garble bool,
 	zig bool,
@@ -183,7 +208,7 @@ func build(
 
 	// XGo entry
 	x = &xgo.Compiler{Garble: garble, Zig: zig}
-	env, e = x.SetupEnv(test.os, test.arch)
+	env, e = x.SetupTargetEnv(test)
 	assert.NoError(t, e)
 	assert.NotNil(t, env)
 
@@ -218,6 +243,42 @@ func build(
 	}
 }
 
+func TestAttach(t *testing.T) {
+	var e error
+	var env map[string]string
+	var fn string = filepath.Join(t.TempDir(), "cat.go")
+	var stdout bytes.Buffer
+	var x *xgo.Compiler = &xgo.Compiler{
+		Stdin:  strings.NewReader("hello\n"),
+		Stdout: &stdout,
+	}
+	var xe *xgo.ExitError
+
+	t.Parallel()
+
+	e = os.WriteFile(
+		fn,
+		[]byte(
+			"package main\n\nimport (\n\"io\"\n\"os\"\n)\n\n"+
+				"func main() {\n"+
+				"_, _ = io.Copy(os.Stdout, os.Stdin)\n}\n",
+		),
+		0o600,
+	)
+	assert.NoError(t, e)
+
+	env, e = x.SetupEnv(runtime.GOOS, runtime.GOARCH)
+	assert.NoError(t, e)
+
+	e = x.Attach(env, "run", fn)
+	assert.NoError(t, e)
+	assert.Equal(t, "hello\n", stdout.String())
+
+	e = x.Attach(env, "run", filepath.Join("testdata", "missing"))
+	assert.ErrorAs(t, e, &xe)
+	assert.True(t, xe.Streamed)
+}
+
 func TestCompileCGOSupported(t *testing.T) {
 	var src string = "main_cgo.go"
 
@@ -228,7 +289,7 @@ func TestCompileCGOSupported(t *testing.T) {
 			"Target("+test.os+"/"+test.arch+")",
 			func(t *testing.T) {
 				t.Parallel()
-				build(t, test, src, false, false, true)
+				build(t, test.target(), src, false, false, true)
 			},
 		)
 	}
@@ -243,8 +304,17 @@ func TestCompileCGOUnsupported(t *testing.T) {
 		t.Run(
 			"Target("+test.os+"/"+test.arch+")",
 			func(t *testing.T) {
+				var pass bool
+
 				t.Parallel()
-				build(t, test, src, false, false, false)
+
+				// Supported only with a cross-compiler
+				if test.target().String() == "linux/arm" {
+					_, e := exec.LookPath("arm-linux-gnueabihf-gcc")
+					pass = e == nil
+				}
+
+				build(t, test.target(), src, false, false, pass)
 			},
 		)
 	}
@@ -260,7 +330,7 @@ func TestCompileCGOZig(t *testing.T) {
 			"Target("+test.os+"/"+test.arch+")",
 			func(t *testing.T) {
 				t.Parallel()
-				build(t, test, src, false, true, true)
+				build(t, test.target(), src, false, true, true)
 			},
 		)
 	}
@@ -276,7 +346,7 @@ func TestCompileSupported(t *testing.T) {
 			"Target("+test.os+"/"+test.arch+")",
 			func(t *testing.T) {
 				t.Parallel()
-				build(t, test, src, false, false, true)
+				build(t, test.target(), src, false, false, true)
 			},
 		)
 	}
@@ -296,7 +366,23 @@ func TestCompileSupportedWithGarble(t *testing.T) {
 			"GarbleTarget("+test.os+"/"+test.arch+")",
 			func(t *testing.T) {
 				t.Parallel()
-				build(t, test, src, true, false, true)
+				build(t, test.target(), src, true, false, true)
+			},
+		)
+	}
+}
+
+func TestCompileVariants(t *testing.T) {
+	var src string = "main.go"
+
+	t.Parallel()
+
+	for _, test := range variantTests {
+		t.Run(
+			"Target("+test.String()+")",
+			func(t *testing.T) {
+				t.Parallel()
+				build(t, test, src, false, false, true)
 			},
 		)
 	}
@@ -312,7 +398,7 @@ func TestCompileUnsupported(t *testing.T) {
 			"Target("+test.os+"/"+test.arch+")",
 			func(t *testing.T) {
 				t.Parallel()
-				build(t, test, src, false, false, false)
+				build(t, test.target(), src, false, false, false)
 			},
 		)
 	}
@@ -334,3 +420,306 @@ func TestDebug(t *testing.T) {
 	assert.NoError(t, e)
 	assert.NotEmpty(t, stdout)
 }
+
+func TestDebugEnv(t *testing.T) {
+	var e error
+	var env map[string]string
+	var stdout string
+	var x *xgo.Compiler = &xgo.Compiler{Debug: true, Shell: "sh"}
+
+	t.Parallel()
+
+	env, e = x.SetupEnv("windows", "amd64")
+	assert.NoError(t, e)
+
+	env["PKG_CONFIG_PATH"] = "/opt/windows/lib/pkgconfig"
+	env["XGO_TEST_UNCHANGED"] = os.Getenv("XGO_TEST_UNCHANGED")
+
+	// By default, only what differs from Go's defaults
+	stdout, e = x.Run(env, "build", ".")
+	assert.NoError(t, e)
+	assert.Contains(t, stdout, "GOARCH=amd64 \\\n")
+	assert.Contains(t, stdout, "GOOS=windows \\\n")
+	assert.Contains(t, stdout, "PKG_CONFIG_PATH=")
+	assert.NotContains(t, stdout, "GOROOT=")
+	assert.NotContains(t, stdout, "XGO_TEST_UNCHANGED=")
+
+	// User-provided list of names and globs
+	x.DebugEnv = []string{"GOOS", "PKG_CONFIG_*"}
+
+	stdout, e = x.Run(env, "build", ".")
+	assert.NoError(t, e)
+	assert.Equal(
+		t,
+		"GOOS=windows \\\n"+
+			"PKG_CONFIG_PATH=/opt/windows/lib/pkgconfig \\\n"+
+			"go build .",
+		stdout,
+	)
+
+	// Everything
+	x.DebugEnv = []string{"*"}
+
+	stdout, e = x.Run(env, "build", ".")
+	assert.NoError(t, e)
+	assert.Contains(t, stdout, "GOROOT=")
+}
+
+func TestExitError(t *testing.T) {
+	var e error
+	var env map[string]string
+	var ee *exec.ExitError
+	var stderr bytes.Buffer
+	var x *xgo.Compiler = &xgo.Compiler{}
+	var xe *xgo.ExitError
+
+	t.Parallel()
+
+	env, e = x.SetupEnv(runtime.GOOS, runtime.GOARCH)
+	assert.NoError(t, e)
+
+	_, e = x.Run(env, "build", filepath.Join("testdata", "missing"))
+	assert.ErrorAs(t, e, &xe)
+	assert.Equal(t, 1, xe.Code)
+	assert.Equal(t, "go", xe.Command[0])
+	assert.Equal(t, "build", xe.Command[1])
+	assert.NotEmpty(t, xe.Stderr)
+	assert.Equal(t, xe.Stderr, e.Error())
+	assert.False(t, xe.Streamed)
+	assert.Equal(t, runtime.GOOS, xe.Target.OS)
+	assert.Equal(t, runtime.GOARCH, xe.Target.Arch)
+	assert.ErrorAs(t, e, &ee)
+
+	// Stderr should still be captured when streaming
+	x.Stderr = &stderr
+
+	e = x.Stream(env, "build", filepath.Join("testdata", "missing"))
+	assert.ErrorAs(t, e, &xe)
+	assert.True(t, xe.Streamed)
+	assert.Equal(t, strings.TrimSpace(stderr.String()), xe.Stderr)
+}
+
+func TestRunContext(t *testing.T) {
+	var cancel context.CancelFunc
+	var ctx context.Context
+	var e error
+	var env map[string]string
+	var fn string = filepath.Join(t.TempDir(), "sleep.go")
+	var start time.Time
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	t.Parallel()
+
+	env, e = x.SetupEnvContext(
+		context.Background(),
+		runtime.GOOS,
+		runtime.GOARCH,
+	)
+	assert.NoError(t, e)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	_, e = x.RunContext(ctx, env, "version")
+	assert.ErrorIs(t, e, context.Canceled)
+
+	_, e = x.SetupEnvContext(ctx, runtime.GOOS, runtime.GOARCH)
+	assert.ErrorIs(t, e, context.Canceled)
+
+	// The program started by "go run" should be killed too
+	e = os.WriteFile(
+		fn,
+		[]byte(
+			"package main\n\nimport \"time\"\n\n"+
+				"func main() { time.Sleep(time.Minute) }\n",
+		),
+		0o600,
+	)
+	assert.NoError(t, e)
+
+	ctx, cancel = context.WithTimeout(
+		context.Background(),
+		5*time.Second,
+	)
+	defer cancel()
+
+	start = time.Now()
+	_, e = x.RunContext(ctx, env, "run", fn)
+	assert.ErrorIs(t, e, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestSetupTargetEnvCGO(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var env map[string]string
+	var host string = xgo.HostTarget().String()
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	if host == "linux/arm" {
+		t.Skip("host is linux/arm")
+	}
+
+	// No cross-compiler, so the host compiler must not be used
+	env, e = x.SetupTargetEnv(xgo.Target{OS: "linux", Arch: "arm"})
+	assert.NoError(t, e)
+
+	if env["CC"] == "" {
+		assert.Equal(t, "0", env["CGO_ENABLED"])
+	}
+
+	x.Zig = true
+
+	env, e = x.SetupTargetEnv(xgo.Target{OS: "linux", Arch: "arm"})
+	assert.NoError(t, e)
+	assert.Equal(t, "1", env["CGO_ENABLED"])
+	assert.Equal(t, "zig cc --target=arm-linux-musleabihf", env["CC"])
+
+	for _, variant := range []string{"5", "7,softfloat"} {
+		env, e = x.SetupTargetEnv(
+			xgo.Target{OS: "linux", Arch: "arm", Variant: variant},
+		)
+		assert.NoError(t, e)
+		assert.Equal(
+			t,
+			"zig cc --target=arm-linux-musleabi",
+			env["CC"],
+		)
+	}
+}
+
+func TestSetupTargetEnvReproducible(t *testing.T) {
+	var e error
+	var env map[string]string
+	var x *xgo.Compiler = &xgo.Compiler{Reproducible: true}
+
+	// Not parallel, as the host env is modified
+	t.Setenv("GIT_SSH_COMMAND", "ssh -o BatchMode=yes")
+	t.Setenv("GOFLAGS", "-trimpath")
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	t.Setenv("XGO_TEST_DROPPED", "1")
+
+	env, e = x.SetupTargetEnv(xgo.HostTarget())
+	assert.NoError(t, e)
+	assert.Equal(t, "ssh -o BatchMode=yes", env["GIT_SSH_COMMAND"])
+	assert.Equal(t, "-trimpath", env["GOFLAGS"])
+	assert.Equal(t, "http://proxy:3128", env["HTTPS_PROXY"])
+	assert.NotContains(t, env, "XGO_TEST_DROPPED")
+	assert.NotEmpty(t, env["SOURCE_DATE_EPOCH"])
+}
+
+func TestSetupTargetEnvVariant(t *testing.T) {
+	var e error
+	var env map[string]string
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	// Not parallel, as the host env is modified
+	t.Setenv("GOARM", "5")
+
+	env, e = x.SetupTargetEnv(xgo.Target{OS: "linux", Arch: "arm"})
+	assert.NoError(t, e)
+	assert.NotEqual(t, "5", env["GOARM"])
+
+	env, e = x.SetupTargetEnv(
+		xgo.Target{OS: "linux", Arch: "arm", Variant: "6"},
+	)
+	assert.NoError(t, e)
+	assert.Equal(t, "6", env["GOARM"])
+}
+
+func TestStream(t *testing.T) {
+	var e error
+	var env map[string]string
+	var stderr bytes.Buffer
+	var stdout bytes.Buffer
+	var x *xgo.Compiler = &xgo.Compiler{
+		Stderr: &stderr,
+		Stdout: &stdout,
+	}
+
+	t.Parallel()
+
+	env, e = x.SetupEnv(runtime.GOOS, runtime.GOARCH)
+	assert.NoError(t, e)
+
+	e = x.Stream(env, "env", "GOOS")
+	assert.NoError(t, e)
+	assert.Equal(t, runtime.GOOS+"\n", stdout.String())
+
+	e = x.Stream(env, "build", filepath.Join("testdata", "missing"))
+	assert.Error(t, e)
+	assert.NotEmpty(t, stderr.String())
+
+	// Build should stream too, rather than buffering
+	stdout.Reset()
+	x.Debug = true
+
+	_, e = x.Build(xgo.HostTarget(), "build", ".")
+	assert.NoError(t, e)
+	assert.Contains(t, stdout.String(), "go build")
+}
+
+func TestStreamStderrTail(t *testing.T) {
+	var e error
+	var env map[string]string
+	var fn string = filepath.Join(t.TempDir(), "noisy.go")
+	var stderr bytes.Buffer
+	var x *xgo.Compiler = &xgo.Compiler{
+		Stderr: &stderr,
+		Stdout: io.Discard,
+	}
+	var xe *xgo.ExitError
+
+	t.Parallel()
+
+	e = os.WriteFile(
+		fn,
+		[]byte(
+			"package main\n\nimport (\n\"os\"\n\"strings\"\n)\n\n"+
+				"func main() {\n"+
+				"x := strings.Repeat(\"x\", 1<<20)\n"+
+				"os.Stderr.WriteString(x + \"end\\n\")\n"+
+				"os.Exit(3)\n}\n",
+		),
+		0o600,
+	)
+	assert.NoError(t, e)
+
+	env, e = x.SetupEnv(runtime.GOOS, runtime.GOARCH)
+	assert.NoError(t, e)
+
+	// All of stderr is streamed, but only the end is kept
+	e = x.Stream(env, "run", fn)
+	assert.ErrorAs(t, e, &xe)
+	assert.Greater(t, stderr.Len(), 1<<20)
+	assert.LessOrEqual(t, len(xe.Stderr), 64<<10)
+	assert.Contains(t, xe.Stderr, "end\n")
+}
+
+func TestTrace(t *testing.T) {
+	var e error
+	var env map[string]string
+	var stdout string
+	var trace bytes.Buffer
+	var x *xgo.Compiler = &xgo.Compiler{Trace: &trace}
+
+	t.Parallel()
+
+	// Internal queries shouldn't be traced
+	env, e = x.SetupEnv(runtime.GOOS, runtime.GOARCH)
+	assert.NoError(t, e)
+	assert.Empty(t, trace.String())
+
+	// Unlike Debug, the command should still run
+	stdout, e = x.Run(env, "env", "GOOS")
+	assert.NoError(t, e)
+	assert.Equal(t, runtime.GOOS, stdout)
+	assert.Contains(t, trace.String(), "go env GOOS\n# done in ")
+
+	trace.Reset()
+
+	_, e = x.Run(env, "build", filepath.Join("testdata", "missing"))
+	assert.Error(t, e)
+	assert.Contains(t, trace.String(), "# exit status 1 in ")
+}
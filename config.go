@@ -0,0 +1,118 @@
+package xgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Config is a struct containing xgo settings, which can be loaded
+// from a JSON config file (see FindConfig).
+type Config struct {
+	Garble   GarbleOptions      `json:"garble"`
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+
+	// Runners is a mapping of targets (os/arch[/variant]) to go test
+	// -exec commands (see Compiler.Runner)
+	Runners map[string]string `json:"runners,omitempty"`
+
+	// Stamp is a mapping of vars (e.g. main.version) to templates
+	// (e.g. {{.Version}}), for -X (see ExpandTemplate)
+	Stamp map[string]string `json:"stamp,omitempty"`
+}
+
+// Profile is a mapping of go command flag names (without leading
+// dashes) to the default values that BuildArgsSanityCheck will add.
+// Boolean flags (e.g. trimpath) use an empty value.
+type Profile map[string]string
+
+// FindConfig will return the path of the config file to use: the
+// XGOCONFIG env var, if set, otherwise .xgo.json in the current
+// directory, otherwise xgo/config.json in the user's config directory
+// (e.g. ~/.config). It returns an empty string if none exist.
+func FindConfig() string {
+	var dir string
+	var e error
+	var fn string
+
+	if fn = os.Getenv("XGOCONFIG"); fn != "" {
+		return fn
+	}
+
+	if _, e = os.Stat(".xgo.json"); e == nil {
+		return ".xgo.json"
+	}
+
+	if dir, e = os.UserConfigDir(); e != nil {
+		return ""
+	}
+
+	fn = filepath.Join(dir, "xgo", "config.json")
+	if _, e = os.Stat(fn); e != nil {
+		return ""
+	}
+
+	return fn
+}
+
+// LoadConfig will read the provided JSON config file. An empty
+// filename will return an empty Config.
+func LoadConfig(fn string) (*Config, error) {
+	var b []byte
+	var c *Config = &Config{}
+	var e error
+
+	if fn == "" {
+		return c, nil
+	}
+
+	if b, e = os.ReadFile(filepath.Clean(fn)); e != nil {
+		if errors.Is(e, fs.ErrNotExist) {
+			return nil, fmt.Errorf("config %s not found", fn)
+		}
+
+		return nil, fmt.Errorf("failed to read %s: %w", fn, e)
+	}
+
+	if e = json.Unmarshal(b, c); e != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fn, e)
+	}
+
+	return c, nil
+}
+
+// Profile will return the named Profile from the Config, if defined
+// there, otherwise from the built-in profiles: debug, hardened,
+// minimal, or release.
+func (c *Config) Profile(name string) (Profile, error) {
+	var names []string
+
+	if p, ok := c.Profiles[name]; ok {
+		return p, nil
+	}
+
+	if p, ok := profiles[name]; ok {
+		return p, nil
+	}
+
+	names = slices.Collect(maps.Keys(profiles))
+	for k := range c.Profiles {
+		if !slices.Contains(names, k) {
+			names = append(names, k)
+		}
+	}
+
+	slices.Sort(names)
+
+	return nil, fmt.Errorf(
+		"unknown profile %s (available: %s)",
+		name,
+		strings.Join(names, ", "),
+	)
+}
@@ -0,0 +1,54 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	var c *xgo.Config
+	var e error
+	var fn string = filepath.Join(t.TempDir(), "config.json")
+	var p xgo.Profile
+
+	c, e = xgo.LoadConfig("")
+	assert.NoError(t, e)
+	assert.Empty(t, c.Profiles)
+
+	_, e = xgo.LoadConfig(fn)
+	assert.Error(t, e)
+
+	e = os.WriteFile(
+		fn,
+		[]byte(`{"profiles": {"release": {"tags": "netgo"}}}`),
+		0o600,
+	)
+	assert.NoError(t, e)
+
+	c, e = xgo.LoadConfig(fn)
+	assert.NoError(t, e)
+
+	// Config profiles override built-in profiles
+	p, e = c.Profile("release")
+	assert.NoError(t, e)
+	assert.Equal(t, xgo.Profile{"tags": "netgo"}, p)
+
+	p, e = c.Profile("hardened")
+	assert.NoError(t, e)
+	assert.Equal(t, "pie", p["buildmode"])
+
+	_, e = c.Profile("missing")
+	assert.ErrorContains(t, e, "debug, hardened, minimal, release")
+
+	assert.NoError(t, os.WriteFile(fn, []byte("{"), 0o600))
+
+	_, e = xgo.LoadConfig(fn)
+	assert.Error(t, e)
+}
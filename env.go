@@ -0,0 +1,164 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ChangedEnv will return the ENV vars from env that differ from host.
+// Empty vars are ignored, as go uses its defaults for them, and so is
+// GOGCCFLAGS, as it's informational and changes with every run.
+func ChangedEnv(
+	env map[string]string,
+	host map[string]string,
+) map[string]string {
+	var changed map[string]string = map[string]string{}
+
+	for k, v := range env {
+		if (k == "GOGCCFLAGS") || (v == "") || (host[k] == v) {
+			continue
+		}
+
+		changed[k] = v
+	}
+
+	return changed
+}
+
+func formatDotenv(k string, v string) string {
+	// Single quotes are literal in most dotenv parsers
+	if !strings.ContainsAny(v, "'\r\n") {
+		return k + "='" + v + "'"
+	}
+
+	return k + "=\"" + strings.NewReplacer(
+		"\\", "\\\\",
+		"\"", "\\\"",
+		"\n", "\\n",
+		"\r", "\\r",
+	).Replace(v) + "\""
+}
+
+// FormatEnv will return the provided ENV vars, sorted by name, in the
+// requested format: sh, fish, powershell, cmd, dotenv, json, make, or
+// github (for $GITHUB_ENV). Values are quoted as needed for each
+// format. Names that aren't valid identifiers are skipped.
+func FormatEnv(env map[string]string, format string) (string, error) {
+	var e error
+	var keys []string
+	var line string
+	var lines []string
+
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		if envName.MatchString(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	if format == "json" {
+		return formatJSON(env, keys)
+	}
+
+	for _, k := range keys {
+		switch format {
+		case "cmd", "fish", "powershell", "sh":
+			if e = checkShell(format, env[k]); e != nil {
+				return "", e
+			}
+
+			line = quoteEnv(format, k, env[k])
+		case "dotenv":
+			line = formatDotenv(k, env[k])
+		case "github":
+			line = formatGitHub(k, env[k])
+		case "make":
+			line, e = formatMake(k, env[k])
+		default:
+			return "", fmt.Errorf("unsupported env format %s", format)
+		}
+
+		if e != nil {
+			return "", e
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func formatGitHub(k string, v string) string {
+	var delim string = "XGO_EOF"
+
+	if !strings.ContainsAny(v, "\r\n") {
+		return k + "=" + v
+	}
+
+	// Multiline values need a delimiter that isn't in the value
+	for strings.Contains(v, delim) {
+		delim += "_"
+	}
+
+	return k + "<<" + delim + "\n" + v + "\n" + delim
+}
+
+func formatJSON(
+	env map[string]string,
+	keys []string,
+) (string, error) {
+	var b bytes.Buffer
+	var enc *json.Encoder = json.NewEncoder(&b)
+	var tmp map[string]string = map[string]string{}
+
+	for _, k := range keys {
+		tmp[k] = env[k]
+	}
+
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if e := enc.Encode(tmp); e != nil {
+		return "", fmt.Errorf("failed to marshal env: %w", e)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func formatMake(k string, v string) (string, error) {
+	if strings.ContainsAny(v, "\r\n") {
+		return "", fmt.Errorf("%s can't contain a newline in make", k)
+	}
+
+	v = strings.NewReplacer("$", "$$", "#", "\\#").Replace(v)
+
+	// Preserve leading whitespace, which make would strip
+	if strings.TrimLeft(v, " \t") != v {
+		v = "$(empty)" + v
+	}
+
+	// A trailing backslash would continue the line
+	if strings.HasSuffix(v, "\\") {
+		v += "$(empty)"
+	}
+
+	return "export " + k + " := " + v, nil
+}
+
+// HostEnv will return the ENV vars for the host, including the
+// default Go env vars, without any changes made for cross-compiling.
+func (x *Compiler) HostEnv() (map[string]string, error) {
+	return x.HostEnvContext(context.Background())
+}
+
+// HostEnvContext is the same as HostEnv, but uses the provided
+// context when querying the go command.
+func (x *Compiler) HostEnvContext(
+	ctx context.Context,
+) (map[string]string, error) {
+	return x.goEnv(ctx, osEnv())
+}
@@ -0,0 +1,109 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestChangedEnv(t *testing.T) {
+	t.Parallel()
+
+	var changed map[string]string = xgo.ChangedEnv(
+		map[string]string{
+			"CC":         "",
+			"GOARCH":     "arm64",
+			"GOGCCFLAGS": "-fPIC",
+			"GOOS":       "linux",
+			"GOROOT":     "/usr/lib/go",
+		},
+		map[string]string{
+			"CC":     "gcc",
+			"GOARCH": "amd64",
+			"GOOS":   "linux",
+			"GOROOT": "/usr/lib/go",
+		},
+	)
+
+	assert.Equal(t, map[string]string{"GOARCH": "arm64"}, changed)
+}
+
+func TestFormatEnv(t *testing.T) {
+	t.Parallel()
+
+	var env map[string]string = map[string]string{
+		"=C:": "C:\\",
+		"A":   "it's $HOME #1 50%",
+		"B":   "x",
+	}
+	var tests map[string]string = map[string]string{
+		"cmd": "set A=it's $HOME #1 50%%\n" +
+			"set B=x",
+		"dotenv": "A=\"it's $HOME #1 50%\"\n" +
+			"B='x'",
+		"fish": "set -gx A 'it\\'s $HOME #1 50%'\n" +
+			"set -gx B 'x'",
+		"github": "A=it's $HOME #1 50%\n" +
+			"B=x",
+		"json": "{\n" +
+			"  \"A\": \"it's $HOME #1 50%\",\n" +
+			"  \"B\": \"x\"\n" +
+			"}",
+		"make": "export A := it's $$HOME \\#1 50%\n" +
+			"export B := x",
+		"powershell": "$env:A = 'it''s $HOME #1 50%'\n" +
+			"$env:B = 'x'",
+		"sh": "export A='it'\\''s $HOME #1 50%'\n" +
+			"export B='x'",
+	}
+
+	for format, expected := range tests {
+		t.Run(
+			format,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var actual string
+				var e error
+
+				actual, e = xgo.FormatEnv(env, format)
+				assert.NoError(t, e)
+				assert.Equal(t, expected, actual)
+			},
+		)
+	}
+
+}
+
+func TestFormatEnvSpecial(t *testing.T) {
+	t.Parallel()
+
+	var actual string
+	var e error
+
+	_, e = xgo.FormatEnv(map[string]string{"A": "a"}, "unknown")
+	assert.Error(t, e)
+
+	_, e = xgo.FormatEnv(map[string]string{"A": "a\nb"}, "cmd")
+	assert.Error(t, e)
+
+	_, e = xgo.FormatEnv(map[string]string{"A": "a\nb"}, "make")
+	assert.Error(t, e)
+
+	// Delimiter must not appear in the value
+	actual, e = xgo.FormatEnv(
+		map[string]string{"A": "a\nXGO_EOF"},
+		"github",
+	)
+	assert.NoError(t, e)
+	assert.Equal(t, "A<<XGO_EOF_\na\nXGO_EOF\nXGO_EOF_", actual)
+
+	actual, e = xgo.FormatEnv(
+		map[string]string{"A": "a\nb"},
+		"dotenv",
+	)
+	assert.NoError(t, e)
+	assert.Equal(t, `A="a\nb"`, actual)
+}
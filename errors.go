@@ -0,0 +1,78 @@
+package xgo
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ExitError is returned when the go command (or garble) runs, but
+// exits with a non-zero status.
+type ExitError struct {
+	Code    int
+	Command []string
+	Stderr  string
+	Target  Target
+
+	// Streamed is true if Stderr was also written to the Compiler's
+	// Stderr as the go command ran, in which case Stderr only holds
+	// the last 64 KiB.
+	Streamed bool
+
+	err *exec.ExitError
+}
+
+// Error will return the go command's stderr, if any, otherwise a
+// message containing the exit status.
+func (e *ExitError) Error() string {
+	if e.Stderr != "" {
+		return e.Stderr
+	}
+
+	return fmt.Sprintf(
+		"%s exited with status %d",
+		strings.Join(e.Command, " "),
+		e.Code,
+	)
+}
+
+// Unwrap will return the underlying *exec.ExitError.
+func (e *ExitError) Unwrap() error {
+	return e.err
+}
+
+// tailWriter keeps only the last bytes written to it, or all of them
+// if max is 0.
+type tailWriter struct {
+	b   []byte
+	max int
+}
+
+// String will return the kept bytes.
+func (w *tailWriter) String() string {
+	return string(w.b)
+}
+
+// Write will keep the end of p, up to the byte limit, and always
+// succeeds.
+func (w *tailWriter) Write(p []byte) (int, error) {
+	var n int = len(p)
+
+	if w.max <= 0 {
+		w.b = append(w.b, p...)
+		return n, nil
+	}
+
+	if len(p) >= w.max {
+		w.b = append(w.b[:0], p[len(p)-w.max:]...)
+		return n, nil
+	}
+
+	if over := len(w.b) + len(p) - w.max; over > 0 {
+		w.b = append(w.b[:0], w.b[over:]...)
+	}
+
+	w.b = append(w.b, p...)
+
+	return n, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package xgo
+
+import (
+	"io"
+	"os/exec"
+)
+
+func setForegroundProcessGroup(
+	_ *exec.Cmd,
+	_ io.Reader,
+) func() error {
+	return func() error { return nil }
+}
+
+func setProcessGroup(_ *exec.Cmd) {}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package xgo
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Return true if the file is xgo's controlling terminal
+func isTerminal(f *os.File) bool {
+	_, e := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPGRP)
+	return e == nil
+}
+
+// Make xgo's process group the terminal's foreground process group
+func setForeground(f *os.File) error {
+	var e error
+	var pgrp int
+
+	if pgrp, e = unix.Getpgid(0); e != nil {
+		return e //nolint:wrapcheck // Nothing to add
+	}
+
+	// xgo is in the background until this succeeds, which would
+	// otherwise stop it with SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	//nolint:wrapcheck // Nothing to add
+	return unix.IoctlSetPointerInt(int(f.Fd()), tiocspgrp, pgrp)
+}
+
+// Put the command in its own process group. If stdin is xgo's
+// terminal, the group is moved to the foreground, so it can still
+// read from the terminal and receive ^C. The returned func gives the
+// terminal back to xgo.
+func setForegroundProcessGroup(
+	cmd *exec.Cmd,
+	stdin io.Reader,
+) func() error {
+	var f *os.File
+	var ok bool
+
+	setProcessGroup(cmd)
+
+	if f, ok = stdin.(*os.File); !ok || !isTerminal(f) {
+		return func() error { return nil }
+	}
+
+	cmd.SysProcAttr.Ctty = int(f.Fd())
+	cmd.SysProcAttr.Foreground = true
+
+	return func() error {
+		return setForeground(f)
+	}
+}
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// Negative pid signals the whole process group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
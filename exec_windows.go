@@ -0,0 +1,42 @@
+//go:build windows
+
+package xgo
+
+import (
+	"io"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// A new process group would have ^C disabled, so only kill the
+// process tree on cancellation
+func setForegroundProcessGroup(
+	cmd *exec.Cmd,
+	_ io.Reader,
+) func() error {
+	cmd.Cancel = killProcessTree(cmd)
+	return func() error { return nil }
+}
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+	cmd.Cancel = killProcessTree(cmd)
+}
+
+func killProcessTree(cmd *exec.Cmd) func() error {
+	return func() error {
+		var pid string = strconv.Itoa(cmd.Process.Pid)
+
+		// Kill the whole process tree, not just the go command
+		//nolint:gosec // G204 - pid is an int
+		e := exec.Command("taskkill", "/F", "/T", "/PID", pid).Run()
+		if e != nil {
+			return cmd.Process.Kill()
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package xgo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GarbleOptions is a struct containing the options for garble. The
+// zero value matches xgo's defaults: -literals, -tiny, and a random
+// seed (or no seed, if the Compiler is Reproducible).
+type GarbleOptions struct {
+	DebugDir   string   `json:"debugdir,omitempty"`
+	Flags      []string `json:"flags,omitempty"` // Extra flags
+	NoLiterals bool     `json:"no_literals,omitempty"`
+	NoTiny     bool     `json:"no_tiny,omitempty"`
+	Seed       string   `json:"seed,omitempty"` // Base64 or random
+}
+
+// GarbleSupports will return true if garble supports the provided go
+// command (build, install, reverse, run, or test). The Compiler will
+// run other go commands without garble.
+func GarbleSupports(command string) bool {
+	return slices.Contains(garbleCommands, command)
+}
+
+// Return a random seed, the same as garble's -seed=random
+func randomSeed() (string, error) {
+	var b []byte = make([]byte, 16) //nolint:mnd // Same as garble
+
+	if _, e := rand.Read(b); e != nil {
+		return "", fmt.Errorf("failed to generate garble seed: %w", e)
+	}
+
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// Return the garble flags for the options, with a random seed, if
+// none was provided and random is true
+func (o GarbleOptions) args(random bool) []string {
+	var args []string
+
+	if o.DebugDir != "" {
+		args = append(args, "--debugdir="+o.DebugDir)
+	}
+
+	if !o.NoLiterals {
+		args = append(args, "--literals")
+	}
+
+	// Without a seed, garble is deterministic
+	switch o.Seed {
+	case "", "random":
+		if random {
+			args = append(args, "--seed=random")
+		}
+	default:
+		args = append(args, "--seed="+o.Seed)
+	}
+
+	if !o.NoTiny {
+		args = append(args, "--tiny")
+	}
+
+	return append(args, o.Flags...)
+}
+
+// Return true if garble will be used for the go command
+func (x *Compiler) garbled(args []string) bool {
+	return x.Garble && (len(args) > 0) && GarbleSupports(args[0])
+}
+
+// Return a copy of the Compiler with the garble seed that will be
+// used, choosing a random one, if needed, so that it can be reported
+// and reused (e.g. to reverse stack traces)
+func (x *Compiler) seeded() (*Compiler, error) {
+	var e error
+	var tmp Compiler = *x
+
+	switch seed := x.GarbleOptions.Seed; {
+	case (seed != "") && (seed != "random"):
+	case x.Reproducible:
+		// No seed is used
+		tmp.GarbleOptions.Seed = ""
+	default:
+		if tmp.GarbleOptions.Seed, e = randomSeed(); e != nil {
+			return nil, e
+		}
+	}
+
+	return &tmp, nil
+}
+
+// Reverse will run "garble reverse" for the provided files (e.g.
+// stack traces), or stdin, if none are provided, using the same
+// Target, garble options (including the seed), build flags, and
+// packages as the BuildResult (e.g. from a Report). It must be run
+// from the same directory as the original build. The de-obfuscated
+// output is written to the Compiler's Stdout (or os.Stdout, if
+// unset).
+func (x *Compiler) Reverse(r *BuildResult, files ...string) error {
+	return x.ReverseContext(context.Background(), r, files...)
+}
+
+// ReverseContext is the same as Reverse, but garble will be killed if
+// the context is canceled.
+func (x *Compiler) ReverseContext(
+	ctx context.Context,
+	r *BuildResult,
+	files ...string,
+) error {
+	var args []string
+	var e error
+	var env map[string]string
+	var tmp Compiler = *x
+
+	switch {
+	case r.Garble == nil:
+		return fmt.Errorf("%s wasn't built with garble", r.Target)
+	case r.Target.Arch == "universal":
+		return errors.New("reverse each input of a universal build")
+	}
+
+	tmp.Garble = true
+	tmp.GarbleOptions = *r.Garble
+
+	if env, e = tmp.SetupTargetEnvContext(ctx, r.Target); e != nil {
+		return e
+	}
+
+	args = append(reverseArgs(r.Command), files...)
+
+	if len(files) == 0 {
+		return tmp.AttachContext(ctx, env, args...)
+	}
+
+	return tmp.StreamContext(ctx, env, args...)
+}
+
+// Return the garble reverse args for the original command (e.g.
+// "garble -seed=... build -tags=a ."), keeping the build flags
+// (except -o) and packages
+func reverseArgs(cmd []string) []string {
+	var a GoArgs
+	var args []string = []string{"reverse"}
+	var i int = 1
+
+	// Skip garble and its flags
+	for (i < len(cmd)) && strings.HasPrefix(cmd[i], "-") {
+		i++
+	}
+
+	if i >= len(cmd) {
+		return args
+	}
+
+	a = ParseGoArgs(cmd[i:], "")
+
+	for _, f := range a.Flags {
+		if f.Name != "o" {
+			args = append(args, "-"+f.Name+"="+f.Value)
+		}
+	}
+
+	return append(args, a.Packages...)
+}
@@ -0,0 +1,192 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+type garbleTest struct {
+	name   string
+	x      *xgo.Compiler
+	random bool // Seed is chosen by Build
+	seed   string
+	out    []string // Without a random seed
+}
+
+func TestGarbleCommands(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{
+		Debug:         true,
+		Garble:        true,
+		GarbleOptions: xgo.GarbleOptions{Seed: "AAAAAAAAAAA"},
+	}
+
+	for _, cmd := range []string{"build", "install", "run", "test"} {
+		assert.True(t, xgo.GarbleSupports(cmd))
+
+		// Every incompatible flag is removed
+		r, e = x.Build(
+			xgo.HostTarget(),
+			cmd,
+			"-trimpath",
+			"--toolexec",
+			"echo",
+			"-v",
+			"--trimpath=true",
+			".",
+		)
+		assert.NoError(t, e)
+		assert.Equal(
+			t,
+			[]string{
+				"garble",
+				"--literals",
+				"--seed=AAAAAAAAAAA",
+				"--tiny",
+				cmd,
+				"-v",
+				".",
+			},
+			r.Command,
+		)
+	}
+
+	assert.False(t, xgo.GarbleSupports("vet"))
+
+	r, e = x.Build(xgo.HostTarget(), "vet", "-trimpath", ".")
+	assert.NoError(t, e)
+	assert.Equal(
+		t,
+		[]string{"go", "vet", "-trimpath", "."},
+		r.Command,
+	)
+}
+
+func TestGarbleOptions(t *testing.T) {
+	t.Parallel()
+
+	var tests []garbleTest = []garbleTest{
+		{
+			"Defaults",
+			&xgo.Compiler{Debug: true, Garble: true},
+			true,
+			"",
+			[]string{"garble", "--literals", "--tiny", "build"},
+		},
+		{
+			"Options",
+			&xgo.Compiler{
+				Debug:  true,
+				Garble: true,
+				GarbleOptions: xgo.GarbleOptions{
+					DebugDir:   "dbg",
+					Flags:      []string{"-debug"},
+					NoLiterals: true,
+					NoTiny:     true,
+					Seed:       "AAAAAAAAAAA",
+				},
+			},
+			false,
+			"AAAAAAAAAAA",
+			[]string{
+				"garble",
+				"--debugdir=dbg",
+				"--seed=AAAAAAAAAAA",
+				"-debug",
+				"build",
+			},
+		},
+		{
+			"Reproducible",
+			&xgo.Compiler{
+				Debug:         true,
+				Garble:        true,
+				GarbleOptions: xgo.GarbleOptions{Seed: "random"},
+				Reproducible:  true,
+			},
+			false,
+			"",
+			[]string{"garble", "--literals", "--tiny", "build"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var cmd []string
+				var e error
+				var r *xgo.BuildResult
+
+				r, e = test.x.Build(xgo.HostTarget(), "build", ".")
+				assert.NoError(t, e)
+				assert.NotNil(t, r.Garble)
+
+				cmd = r.Command
+
+				// A random seed is chosen, so it can be reported
+				if test.random {
+					assert.NotEmpty(t, r.Garble.Seed)
+					assert.Contains(t, cmd, "--seed="+r.Garble.Seed)
+
+					cmd = slices.DeleteFunc(
+						slices.Clone(cmd),
+						func(arg string) bool {
+							return arg == "--seed="+r.Garble.Seed
+						},
+					)
+				} else {
+					assert.Equal(t, test.seed, r.Garble.Seed)
+				}
+
+				assert.Equal(t, test.out, cmd[:len(test.out)])
+			},
+		)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	var r *xgo.BuildResult = &xgo.BuildResult{
+		Command: []string{
+			"garble",
+			"--seed=AAAAAAAAAAA",
+			"build",
+			"-o",
+			"out",
+			"--tags=a",
+			".",
+		},
+		Garble: &xgo.GarbleOptions{NoTiny: true, Seed: "AAAAAAAAAAA"},
+		Target: xgo.HostTarget(),
+	}
+	var x *xgo.Compiler = &xgo.Compiler{Debug: true, Stdout: &b}
+
+	assert.NoError(t, x.Reverse(r, "trace.txt"))
+	assert.True(
+		t,
+		strings.HasSuffix(
+			strings.TrimSpace(b.String()),
+			"garble --literals --seed=AAAAAAAAAAA reverse -tags=a . "+
+				"trace.txt",
+		),
+		b.String(),
+	)
+
+	// Not garbled
+	r.Garble = nil
+	assert.Error(t, x.Reverse(r, "trace.txt"))
+}
@@ -0,0 +1,251 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// GitInfo is a struct containing the version control state of a git
+// repository, for stamping builds.
+type GitInfo struct {
+	Commit     string    `json:"commit"`
+	CommitTime time.Time `json:"commit_time"`
+	Dirty      bool      `json:"dirty"`
+	Version    string    `json:"version"` // git describe
+}
+
+// TemplateData is a struct containing the values available to
+// templates for output paths and stamped vars (see ExpandTemplate).
+type TemplateData struct {
+	*GitInfo
+
+	Arch    string
+	Ext     string // ".exe" for windows, otherwise empty
+	OS      string
+	Target  string // os/arch[/variant]
+	Variant string
+}
+
+// ExpandTemplate will expand the provided text/template (e.g.
+// "dist/app_{{.Version}}_{{.OS}}_{{.Arch}}{{.Ext}}") using the
+// provided Target and GitInfo. If the GitInfo is nil, templates that
+// use it will return an error.
+func ExpandTemplate(
+	tmpl string,
+	t Target,
+	g *GitInfo,
+) (string, error) {
+	var b bytes.Buffer
+	var data TemplateData = TemplateData{
+		GitInfo: g,
+		Arch:    t.Arch,
+		OS:      t.OS,
+		Target:  t.String(),
+		Variant: t.Variant,
+	}
+	var e error
+	var tpl *template.Template
+
+	if t.OS == "windows" {
+		data.Ext = ".exe"
+	}
+
+	tpl, e = template.New("xgo").Parse(tmpl)
+	if e != nil {
+		return "", fmt.Errorf("invalid template %q: %w", tmpl, e)
+	}
+
+	if e = tpl.Execute(&b, data); e != nil {
+		return "", fmt.Errorf("failed to expand %q: %w", tmpl, e)
+	}
+
+	return b.String(), nil
+}
+
+func git(
+	ctx context.Context,
+	dir string,
+	args ...string,
+) (string, error) {
+	var cmd *exec.Cmd
+	var e error
+	var errb bytes.Buffer
+	var out []byte
+
+	cmd = exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &errb
+
+	if out, e = cmd.Output(); e != nil {
+		if errb.Len() > 0 {
+			e = fmt.Errorf("%s", strings.TrimSpace(errb.String()))
+		}
+
+		return "", fmt.Errorf("git %s failed: %w", args[0], e)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ReadGitInfo will use the git CLI to read the state of the git
+// repository containing dir (or the current directory, if empty).
+// Version is "git describe --tags --always --dirty", so it falls back
+// to the abbreviated commit if there are no tags.
+func ReadGitInfo(ctx context.Context, dir string) (*GitInfo, error) {
+	var e error
+	var epoch int64
+	var g *GitInfo = &GitInfo{}
+	var out string
+
+	if g.Commit, e = git(ctx, dir, "rev-parse", "HEAD"); e != nil {
+		return nil, e
+	}
+
+	out, e = git(ctx, dir, "show", "-s", "--format=%ct", "HEAD")
+	if e != nil {
+		return nil, e
+	}
+
+	if epoch, e = strconv.ParseInt(out, 10, 64); e != nil {
+		return nil, fmt.Errorf("invalid commit time %s: %w", out, e)
+	}
+
+	g.CommitTime = time.Unix(epoch, 0).UTC()
+
+	out, e = git(
+		ctx,
+		dir,
+		"status",
+		"--porcelain",
+		"--untracked-files=no",
+	)
+	if e != nil {
+		return nil, e
+	}
+
+	g.Dirty = out != ""
+
+	g.Version, e = git(
+		ctx,
+		dir,
+		"describe",
+		"--tags",
+		"--always",
+		"--dirty",
+	)
+	if e != nil {
+		return nil, e
+	}
+
+	return g, nil
+}
+
+// StampArgs will return a copy of the provided go command args with
+// "-X name=value" for each of the provided vars (e.g. main.version)
+// merged into -ldflags. Vars that are already set with -X are not
+// changed.
+func StampArgs(args []string, vars map[string]string) []string {
+	var a GoArgs
+	var have string
+	var i int
+	var pos []int
+	var tmp []string
+	var v string
+
+	if (len(args) == 0) || (len(vars) == 0) {
+		return args
+	}
+
+	// Only for commands that link
+	switch args[0] {
+	case "build", "get", "install", "run", "test":
+	default:
+		return args
+	}
+
+	a, pos = parseGoArgs(args, os.Getenv("GOFLAGS"))
+	tmp = slices.Clone(args)
+
+	if i = a.index("ldflags"); i >= 0 {
+		have = a.Flags[i].Value
+	}
+
+	// Flags from GOFLAGS are overridden, rather than changed
+	switch v = stampFlag(have, vars); {
+	case v == have:
+	case (i < 0) || (pos[i] < 0):
+		return slices.Concat(
+			tmp[:1],
+			[]string{"--ldflags=" + v},
+			tmp[1:],
+		)
+	default:
+		setFlag(tmp, pos[i], v)
+	}
+
+	return tmp
+}
+
+func stampFlag(have string, vars map[string]string) string {
+	var found []string
+	var missing []string
+	var name string
+	var pattern string
+	var v string
+
+	pattern, have = splitPattern(have)
+
+	for _, group := range flagGroups(have) {
+		if flagName(group[0]) != "X" {
+			continue
+		}
+
+		// Either -X=name=value or -X name=value
+		if _, v, _ = strings.Cut(group[0], "="); len(group) > 1 {
+			v = group[1]
+		}
+
+		name, _, _ = strings.Cut(v, "=")
+		found = append(found, name)
+	}
+
+	for _, name = range slices.Sorted(maps.Keys(vars)) {
+		if slices.Contains(found, name) {
+			continue
+		}
+
+		missing = append(missing, "-X", goQuote(name+"="+vars[name]))
+	}
+
+	if len(missing) == 0 {
+		return pattern + have
+	}
+
+	return pattern + strings.TrimSpace(
+		have+" "+strings.Join(missing, " "),
+	)
+}
+
+// Date will return the commit time in RFC 3339 format (UTC).
+func (g GitInfo) Date() string {
+	return g.CommitTime.Format(time.RFC3339)
+}
+
+// ShortCommit will return the first 12 characters of the commit.
+func (g GitInfo) ShortCommit() string {
+	// Same length as Go's pseudo-versions
+	if len(g.Commit) > 12 { //nolint:mnd // See above
+		return g.Commit[:12]
+	}
+
+	return g.Commit
+}
@@ -0,0 +1,138 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var g *xgo.GitInfo = &xgo.GitInfo{
+		Commit:     "0123456789abcdef",
+		CommitTime: time.Unix(0, 0).UTC(),
+		Version:    "v1.2.3",
+	}
+	var out string
+	var tgt xgo.Target = xgo.Target{OS: "windows", Arch: "amd64"}
+
+	out, e = xgo.ExpandTemplate(
+		"app_{{.Version}}_{{.OS}}_{{.Arch}}{{.Ext}}",
+		tgt,
+		g,
+	)
+	assert.NoError(t, e)
+	assert.Equal(t, "app_v1.2.3_windows_amd64.exe", out)
+
+	out, e = xgo.ExpandTemplate("{{.ShortCommit}} {{.Date}}", tgt, g)
+	assert.NoError(t, e)
+	assert.Equal(t, "0123456789ab 1970-01-01T00:00:00Z", out)
+
+	// Git info is required, if used
+	out, e = xgo.ExpandTemplate("{{.Target}}", tgt, nil)
+	assert.NoError(t, e)
+	assert.Equal(t, "windows/amd64", out)
+
+	_, e = xgo.ExpandTemplate("{{.Version}}", tgt, nil)
+	assert.Error(t, e)
+
+	_, e = xgo.ExpandTemplate("{{.Version", tgt, g)
+	assert.Error(t, e)
+}
+
+func TestReadGitInfo(t *testing.T) {
+	t.Parallel()
+
+	var dir string = t.TempDir()
+	var e error
+	var g *xgo.GitInfo
+
+	if _, e = exec.LookPath("git"); e != nil {
+		t.Skip("git not found")
+	}
+
+	git := func(args ...string) {
+		var cmd *exec.Cmd = exec.Command("git", args...)
+
+		cmd.Dir = dir
+		cmd.Env = append(
+			os.Environ(),
+			"GIT_AUTHOR_DATE=@86400 +0000",
+			"GIT_AUTHOR_EMAIL=xgo@example.com",
+			"GIT_AUTHOR_NAME=xgo",
+			"GIT_COMMITTER_DATE=@86400 +0000",
+			"GIT_COMMITTER_EMAIL=xgo@example.com",
+			"GIT_COMMITTER_NAME=xgo",
+		)
+
+		assert.NoError(t, cmd.Run())
+	}
+
+	_, e = xgo.ReadGitInfo(context.Background(), dir)
+	assert.Error(t, e)
+
+	git("init", "-q")
+	assert.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0o600),
+	)
+	git("add", "a")
+	git("commit", "-q", "-m", "a")
+	git("tag", "v1.0.0")
+
+	g, e = xgo.ReadGitInfo(context.Background(), dir)
+	assert.NoError(t, e)
+	assert.Len(t, g.Commit, 40)
+	assert.Equal(t, time.Unix(86400, 0).UTC(), g.CommitTime)
+	assert.False(t, g.Dirty)
+	assert.Equal(t, "v1.0.0", g.Version)
+
+	assert.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "a"), []byte("b"), 0o600),
+	)
+
+	g, e = xgo.ReadGitInfo(context.Background(), dir)
+	assert.NoError(t, e)
+	assert.True(t, g.Dirty)
+	assert.Equal(t, "v1.0.0-dirty", g.Version)
+}
+
+func TestStampArgs(t *testing.T) {
+	t.Parallel()
+
+	var vars map[string]string = map[string]string{
+		"main.a": "1",
+		"main.b": "x y",
+	}
+
+	assert.Equal(
+		t,
+		[]string{"vet", "."},
+		xgo.StampArgs([]string{"vet", "."}, vars),
+	)
+	assert.Equal(
+		t,
+		[]string{
+			"build", "--ldflags=-X main.a=1 -X 'main.b=x y'", ".",
+		},
+		xgo.StampArgs([]string{"build", "."}, vars),
+	)
+	assert.Equal(
+		t,
+		[]string{"build", "-ldflags", "-s -X=main.a=2 -X main.b=1"},
+		xgo.StampArgs(
+			[]string{"build", "-ldflags", "-s -X=main.a=2"},
+			map[string]string{"main.a": "1", "main.b": "1"},
+		),
+	)
+}
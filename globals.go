@@ -1,9 +1,27 @@
 package xgo
 
+import (
+	"regexp"
+	"sync"
+)
+
 // Version is the package version.
 const Version = "0.3.8"
 
-// crossCC is a mapping of GOHOSTOS/GOOS/GOARCH to CC and CXX.
+// maxStderr is the number of bytes of streamed stderr to keep for an
+// ExitError.
+const maxStderr int = 64 << 10
+
+// smokeBytes is the maximum number of bytes of output to keep from a
+// smoke test (see Compiler.Smoke).
+const smokeBytes int = 4 << 10
+
+// smokeLines is the number of lines of output to keep from a smoke
+// test (see Compiler.Smoke).
+const smokeLines int = 10
+
+// crossCC is a mapping of GOHOSTOS/GOOS/GOARCH[/variant] to CC and
+// CXX.
 var crossCC = map[string]map[string]map[string][]string{
 	"darwin": {
 		"linux": {
@@ -32,6 +50,22 @@ var crossCC = map[string]map[string]map[string][]string{
 			"amd64": {"o64-clang", "o64-clang++"},
 			"arm64": {"oa64-clang", "oa64-clang++"},
 		},
+		"linux": {
+			// gcc-arm-linux-gnueabihf
+			"arm": {
+				"arm-linux-gnueabihf-gcc",
+				"arm-linux-gnueabihf-g++",
+			},
+			// gcc-arm-linux-gnueabi
+			"arm/5": {
+				"arm-linux-gnueabi-gcc",
+				"arm-linux-gnueabi-g++",
+			},
+			"arm/softfloat": {
+				"arm-linux-gnueabi-gcc",
+				"arm-linux-gnueabi-g++",
+			},
+		},
 		"windows": {
 			// mingw-w64
 			"386": {"i686-w64-mingw32-gcc", "i686-w64-mingw32-g++"},
@@ -57,3 +91,246 @@ var crossCC = map[string]map[string]map[string][]string{
 		},
 	},
 }
+
+// envName matches ENV var names that are safe in every env format.
+var envName *regexp.Regexp = regexp.MustCompile(
+	`^[A-Za-z_][A-Za-z0-9_]*$`,
+)
+
+// garbleCommands is the list of go commands that garble supports.
+var garbleCommands []string = []string{
+	"build",
+	"install",
+	"reverse",
+	"run",
+	"test",
+}
+
+// garbleIncompatible is the list of go command flags that garble
+// rejects, or sets itself, which are removed when using it.
+var garbleIncompatible []string = []string{"toolexec", "trimpath"}
+
+// goEnvCache is the output of internal go env queries, by env and
+// args (see Compiler.queryEnv).
+var goEnvCache sync.Map
+
+// keepEnv is the list of host env vars kept for reproducible builds,
+// as they're needed to find and run the toolchains and modules, but
+// don't change the output. GOFLAGS is also kept, as it was already
+// read by BuildArgsSanityCheck. Entries ending in "*" are prefixes.
+var keepEnv []string = []string{
+	"APPDATA",
+	"COMSPEC",
+	"GIT_*",
+	"GOCACHE",
+	"GOENV",
+	"GOFLAGS",
+	"GOINSECURE",
+	"GOMODCACHE",
+	"GONOPROXY",
+	"GONOSUMDB",
+	"GOPATH",
+	"GOPRIVATE",
+	"GOPROXY",
+	"GOROOT",
+	"GOSUMDB",
+	"GOTOOLCHAIN",
+	"HOME",
+	"HTTPS_PROXY",
+	"HTTP_PROXY",
+	"LOCALAPPDATA",
+	"NO_PROXY",
+	"PATH",
+	"PATHEXT",
+	"SOURCE_DATE_EPOCH",
+	"SSH_AUTH_SOCK",
+	"SSL_CERT_DIR",
+	"SSL_CERT_FILE",
+	"SYSTEMROOT",
+	"TEMP",
+	"TMP",
+	"TMPDIR",
+	"USERPROFILE",
+	"XDG_CACHE_HOME",
+	"XDG_CONFIG_HOME",
+}
+
+// listFlags is a list of go command flags whose values are lists,
+// which BuildArgsSanityCheck can merge defaults into.
+var listFlags []string = []string{"gcflags", "ldflags", "tags"}
+
+// majorVersion matches the major version suffix of a module path.
+var majorVersion *regexp.Regexp = regexp.MustCompile(`^v[0-9]+$`)
+
+// profiles is a mapping of built-in profile names to the default
+// flags that BuildArgsSanityCheck will add.
+var profiles = map[string]Profile{
+	// Keep symbols and disable optimizations, for debuggers
+	"debug": {"buildvcs": "false", "gcflags": "all=-N -l"},
+	// PIE and full RELRO
+	"hardened": {
+		"buildmode": "pie",
+		"buildvcs":  "false",
+		"ldflags":   "-s -w -bindnow",
+		"trimpath":  "",
+	},
+	"minimal": {},
+	"release": {
+		"buildvcs": "false",
+		"ldflags":  "-s -w",
+		"trimpath": "",
+	},
+}
+
+// runners is a mapping of GOOS/GOARCH[/variant] to the commands (in
+// order of preference) that can run its binaries on another host, for
+// go test -exec (see Compiler.Runner).
+var runners = map[string][]runner{
+	"js/wasm": {
+		{
+			cmd:  []string{"${GOROOT}/lib/wasm/go_js_wasm_exec"},
+			need: "node",
+		},
+		{
+			cmd:  []string{"${GOROOT}/misc/wasm/go_js_wasm_exec"},
+			need: "node",
+		},
+	},
+	"linux/386":           qemu("i386", "i686-linux-gnu"),
+	"linux/amd64":         qemu("x86_64", "x86_64-linux-gnu"),
+	"linux/arm":           qemu("arm", "arm-linux-gnueabihf"),
+	"linux/arm/5":         qemu("arm", "arm-linux-gnueabi"),
+	"linux/arm/softfloat": qemu("arm", "arm-linux-gnueabi"),
+	"linux/arm64":         qemu("aarch64", "aarch64-linux-gnu"),
+	"linux/loong64": qemu(
+		"loongarch64",
+		"loongarch64-linux-gnu",
+	),
+	"linux/mips":   qemu("mips", "mips-linux-gnu"),
+	"linux/mips64": qemu("mips64", "mips64-linux-gnuabi64"),
+	"linux/mips64le": qemu(
+		"mips64el",
+		"mips64el-linux-gnuabi64",
+	),
+	"linux/mipsle":  qemu("mipsel", "mipsel-linux-gnu"),
+	"linux/ppc64":   qemu("ppc64", "powerpc64-linux-gnu"),
+	"linux/ppc64le": qemu("ppc64le", "powerpc64le-linux-gnu"),
+	"linux/riscv64": qemu("riscv64", "riscv64-linux-gnu"),
+	"linux/s390x":   qemu("s390x", "s390x-linux-gnu"),
+	"wasip1/wasm": {
+		{
+			cmd:  []string{"${GOROOT}/lib/wasm/go_wasip1_wasm_exec"},
+			need: "wasmtime",
+		},
+		{
+			cmd:  []string{"${GOROOT}/misc/wasm/go_wasip1_wasm_exec"},
+			need: "wasmtime",
+		},
+	},
+	"windows/386": {{cmd: []string{"wine"}}},
+	"windows/amd64": {
+		{cmd: []string{"wine64"}},
+		{cmd: []string{"wine"}},
+	},
+}
+
+// valueFlags is a list of go command flags (build and test) that
+// take a value, so the value may be the next arg.
+var valueFlags []string = []string{
+	"C",
+	"asmflags",
+	"bench",
+	"benchtime",
+	"blockprofile",
+	"blockprofilerate",
+	"buildmode",
+	"compiler",
+	"count",
+	"covermode",
+	"coverpkg",
+	"coverprofile",
+	"cpu",
+	"cpuprofile",
+	"exec",
+	"fuzz",
+	"fuzzminimizetime",
+	"fuzztime",
+	"gccgoflags",
+	"gcflags",
+	"installsuffix",
+	"ldflags",
+	"list",
+	"memprofile",
+	"memprofilerate",
+	"mod",
+	"modfile",
+	"mutexprofile",
+	"mutexprofilefraction",
+	"o",
+	"outputdir",
+	"overlay",
+	"p",
+	"parallel",
+	"pgo",
+	"pkgdir",
+	"run",
+	"shuffle",
+	"skip",
+	"tags",
+	"timeout",
+	"toolexec",
+	"trace",
+	"vet",
+}
+
+// variants is a mapping of GOARCH to the env var, values, and options
+// used to select an architecture variant.
+var variants = map[string]variant{
+	"386": {env: "GO386", values: []string{"sse2", "softfloat"}},
+	"amd64": {
+		env:    "GOAMD64",
+		values: []string{"v1", "v2", "v3", "v4"},
+	},
+	"arm": {
+		env:    "GOARM",
+		opts:   []string{"hardfloat", "softfloat"},
+		values: []string{"5", "6", "7"},
+	},
+	"arm64": {
+		env:  "GOARM64",
+		opts: []string{"crypto", "lse"},
+		values: []string{
+			"v8.0", "v8.1", "v8.2", "v8.3", "v8.4",
+			"v8.5", "v8.6", "v8.7", "v8.8", "v8.9",
+			"v9.0", "v9.1", "v9.2", "v9.3", "v9.4", "v9.5",
+		},
+	},
+	"mips": {
+		env:    "GOMIPS",
+		values: []string{"hardfloat", "softfloat"},
+	},
+	"mips64": {
+		env:    "GOMIPS64",
+		values: []string{"hardfloat", "softfloat"},
+	},
+	"mips64le": {
+		env:    "GOMIPS64",
+		values: []string{"hardfloat", "softfloat"},
+	},
+	"mipsle": {
+		env:    "GOMIPS",
+		values: []string{"hardfloat", "softfloat"},
+	},
+	"ppc64": {
+		env:    "GOPPC64",
+		values: []string{"power8", "power9", "power10"},
+	},
+	"ppc64le": {
+		env:    "GOPPC64",
+		values: []string{"power8", "power9", "power10"},
+	},
+	"riscv64": {
+		env:    "GORISCV64",
+		values: []string{"rva20u64", "rva22u64", "rva23u64"},
+	},
+}
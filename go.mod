@@ -7,6 +7,7 @@ require (
 	github.com/mjwhitta/hilighter v1.15.2
 	github.com/mjwhitta/log v1.8.10
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.40.0
 )
 
 require (
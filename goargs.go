@@ -0,0 +1,341 @@
+package xgo
+
+import (
+	"slices"
+	"strings"
+)
+
+// GoArgs is a struct containing a go command's args, parsed the same
+// way the go command parses them.
+type GoArgs struct {
+	Command  string
+	Flags    []GoFlag // GOFLAGS first, so later (cli) flags win
+	Packages []string
+	Tail     []string // Args for the program (run) or test binary
+}
+
+// GoFlag is a struct containing a single go command flag.
+type GoFlag struct {
+	Env   bool   // From GOFLAGS, rather than the cli
+	Name  string // Without leading dashes
+	Value string // "true" for boolean flags without a value
+}
+
+// Split a list of tool flags (e.g. for -ldflags) into groups of a
+// flag and any values that follow it (e.g. -X main.v=1)
+func flagGroups(v string) [][]string {
+	var groups [][]string
+
+	for _, word := range splitQuoted(v) {
+		if strings.HasPrefix(word, "-") || (len(groups) == 0) {
+			groups = append(groups, []string{word})
+			continue
+		}
+
+		groups[len(groups)-1] = append(groups[len(groups)-1], word)
+	}
+
+	return groups
+}
+
+// Return the name of a tool flag (e.g. "X" for -X=main.v=1)
+func flagName(word string) string {
+	var name string
+
+	name, _, _ = strings.Cut(strings.TrimLeft(word, "-"), "=")
+
+	return name
+}
+
+// Quote a value for a tool flag list, the same as the go command
+func goQuote(v string) string {
+	switch {
+	case !strings.ContainsAny(v, " \t\n\r'\""):
+		return v
+	case !strings.Contains(v, "'"):
+		return "'" + v + "'"
+	default:
+		return "\"" + v + "\""
+	}
+}
+
+// Merge the wanted values for a list flag (gcflags, ldflags, or
+// tags) into the values the user provided, skipping any that were
+// already provided (even with a different value, e.g. -w=false). The
+// user's package pattern is kept.
+func mergeFlag(name string, have string, want string) string {
+	var found []string
+	var missing []string
+	var pattern string
+
+	if name == "tags" {
+		// Tags are comma-separated, or space-separated (legacy)
+		found = strings.FieldsFunc(
+			have,
+			func(r rune) bool {
+				return (r == ',') || (r == ' ')
+			},
+		)
+
+		for tag := range strings.SplitSeq(want, ",") {
+			if (tag != "") && !slices.Contains(found, tag) {
+				missing = append(missing, tag)
+			}
+		}
+
+		return strings.Join(slices.Concat(found, missing), ",")
+	}
+
+	pattern, have = splitPattern(have)
+	_, want = splitPattern(want)
+
+	for _, group := range flagGroups(have) {
+		found = append(found, flagName(group[0]))
+	}
+
+	for _, group := range flagGroups(want) {
+		if slices.Contains(found, flagName(group[0])) {
+			continue
+		}
+
+		for _, word := range group {
+			if strings.ContainsAny(word, " \t") {
+				word = "'" + word + "'"
+			}
+
+			missing = append(missing, word)
+		}
+	}
+
+	if len(missing) == 0 {
+		return pattern + have
+	}
+
+	return pattern + strings.TrimSpace(
+		have+" "+strings.Join(missing, " "),
+	)
+}
+
+func parseGoFlag(arg string, next []string) (GoFlag, int) {
+	var f GoFlag
+	var found bool
+	var name string
+
+	arg = strings.TrimLeft(arg, "-")
+	f.Name, f.Value, found = strings.Cut(arg, "=")
+	name = strings.TrimPrefix(f.Name, "test.")
+
+	switch {
+	case found:
+		return f, 1
+	case !slices.Contains(valueFlags, name):
+		// Boolean flags only accept a value with "="
+		f.Value = "true"
+		return f, 1
+	case len(next) == 0:
+		// Missing value, which go will complain about
+		return f, 1
+	}
+
+	f.Value = next[0]
+
+	return f, 2
+}
+
+// ParseGoArgs will parse the provided go command args (e.g. "build",
+// "-o", "out", ".") and goflags (e.g. the GOFLAGS env var). Like the
+// go command, flags can use one or two dashes, values can follow "="
+// or be the next arg (except for boolean flags), and flags stop at
+// "--" or the first non-flag arg. Go test also allows flags after its
+// packages, until -args. For go run, everything after the package (or
+// .go files) is passed to the program.
+func ParseGoArgs(args []string, goflags string) GoArgs {
+	var a GoArgs
+
+	a, _ = parseGoArgs(args, goflags)
+
+	return a
+}
+
+// parseGoArgs is the same as ParseGoArgs, but also returns the index
+// in args of each flag (or -1 for GOFLAGS).
+func parseGoArgs(args []string, goflags string) (GoArgs, []int) {
+	var a GoArgs
+	var done bool
+	var f GoFlag
+	var n int
+	var pos []int
+
+	for arg := range strings.FieldsSeq(goflags) {
+		if strings.HasPrefix(arg, "-") {
+			f, _ = parseGoFlag(arg, nil)
+			f.Env = true
+			a.Flags = append(a.Flags, f)
+			pos = append(pos, -1)
+		}
+	}
+
+	if len(args) == 0 {
+		return a, pos
+	}
+
+	a.Command = args[0]
+
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case done || (arg == "-") || !strings.HasPrefix(arg, "-"):
+			if a.runArgs(arg) {
+				a.Tail = args[i:]
+				return a, pos
+			}
+
+			a.Packages = append(a.Packages, arg)
+			done = a.Command != "test"
+		case arg == "--":
+			done = true
+		case a.testArgs(arg):
+			a.Tail = args[i+1:]
+			return a, pos
+		default:
+			f, n = parseGoFlag(arg, args[i+1:])
+			a.Flags = append(a.Flags, f)
+			pos = append(pos, i)
+			i += n - 1
+		}
+	}
+
+	return a, pos
+}
+
+// Return a copy of args without any of the named flags (or their
+// values)
+func removeFlags(args []string, names ...string) []string {
+	var a GoArgs
+	var n int
+	var pos []int
+	var tmp []string = slices.Clone(args)
+
+	a, pos = parseGoArgs(args, "")
+
+	// Backward, so the earlier indexes are still valid
+	for i := len(a.Flags) - 1; i >= 0; i-- {
+		if !slices.Contains(names, a.Flags[i].Name) {
+			continue
+		}
+
+		_, n = parseGoFlag(args[pos[i]], args[pos[i]+1:])
+		tmp = slices.Delete(tmp, pos[i], pos[i]+n)
+	}
+
+	return tmp
+}
+
+// Set the value of the flag at index i in args, in place
+func setFlag(args []string, i int, value string) {
+	if name, _, ok := strings.Cut(args[i], "="); ok {
+		args[i] = name + "=" + value
+	} else if i+1 < len(args) {
+		args[i+1] = value
+	}
+}
+
+// Split the package pattern (e.g. "all=") from a tool flag list
+func splitPattern(v string) (string, string) {
+	var found bool
+	var pattern string
+	var rest string
+
+	if strings.HasPrefix(v, "-") {
+		return "", v
+	}
+
+	pattern, rest, found = strings.Cut(v, "=")
+	if !found || strings.ContainsAny(pattern, " \t") {
+		return "", v
+	}
+
+	return pattern + "=", rest
+}
+
+// Split a tool flag list on whitespace, respecting single and double
+// quotes, the same as the go command
+func splitQuoted(v string) []string {
+	var inWord bool
+	var quote rune
+	var word strings.Builder
+	var words []string
+
+	for _, c := range v {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case (c == '\'') || (c == '"'):
+			quote = c
+			inWord = true
+		case strings.ContainsRune(" \t\n\r", c):
+			if inWord {
+				words = append(words, word.String())
+			}
+
+			word.Reset()
+			inWord = false
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// Flag will return the value of the named flag (without leading
+// dashes), and whether it was found. If a flag was provided more
+// than once, the last value is returned, so the cli overrides
+// GOFLAGS.
+func (a GoArgs) Flag(name string) (string, bool) {
+	if i := a.index(name); i >= 0 {
+		return a.Flags[i].Value, true
+	}
+
+	return "", false
+}
+
+// Return the index of the last instance of the named flag, or -1
+func (a GoArgs) index(name string) int {
+	for i, f := range slices.Backward(a.Flags) {
+		if f.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Return true if arg is the first arg for the program, rather than a
+// package, for go run
+func (a GoArgs) runArgs(arg string) bool {
+	if (a.Command != "run") || (len(a.Packages) == 0) {
+		return false
+	}
+
+	// Go files are the only way to provide multiple packages
+	return !strings.HasSuffix(a.Packages[0], ".go") ||
+		!strings.HasSuffix(arg, ".go")
+}
+
+// Return true if arg starts the args for the test binary, for go test
+func (a GoArgs) testArgs(arg string) bool {
+	if a.Command != "test" {
+		return false
+	}
+
+	return strings.TrimLeft(arg, "-") == "args"
+}
@@ -0,0 +1,131 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+type goArgsTest struct {
+	name string
+	in   []string
+	out  xgo.GoArgs
+}
+
+func TestGoArgsFlag(t *testing.T) {
+	t.Parallel()
+
+	var a xgo.GoArgs = xgo.ParseGoArgs(
+		[]string{"build", "-tags=b", "."},
+		"-tags=a -trimpath",
+	)
+	var ok bool
+	var v string
+
+	// The cli overrides GOFLAGS
+	v, ok = a.Flag("tags")
+	assert.True(t, ok)
+	assert.Equal(t, "b", v)
+
+	v, ok = a.Flag("trimpath")
+	assert.True(t, ok)
+	assert.Equal(t, "true", v)
+
+	_, ok = a.Flag("ldflags")
+	assert.False(t, ok)
+}
+
+func TestParseGoArgs(t *testing.T) {
+	t.Parallel()
+
+	var tests []goArgsTest = []goArgsTest{
+		{"Nothing", nil, xgo.GoArgs{}},
+		{
+			"Dashes",
+			[]string{"build", "-ldflags=-s -w", "--trimpath", "."},
+			xgo.GoArgs{
+				Command: "build",
+				Flags: []xgo.GoFlag{
+					{Name: "ldflags", Value: "-s -w"},
+					{Name: "trimpath", Value: "true"},
+				},
+				Packages: []string{"."},
+			},
+		},
+		{
+			"Values",
+			[]string{"build", "-o", "-trimpath", "--tags", "a", "."},
+			xgo.GoArgs{
+				Command: "build",
+				Flags: []xgo.GoFlag{
+					{Name: "o", Value: "-trimpath"},
+					{Name: "tags", Value: "a"},
+				},
+				Packages: []string{"."},
+			},
+		},
+		{
+			"Booleans",
+			[]string{"build", "-buildvcs", "false", "-a=false"},
+			xgo.GoArgs{
+				Command: "build",
+				Flags: []xgo.GoFlag{
+					{Name: "buildvcs", Value: "true"},
+				},
+				Packages: []string{"false", "-a=false"},
+			},
+		},
+		{
+			"Separator",
+			[]string{"install", "--", "-trimpath"},
+			xgo.GoArgs{
+				Command:  "install",
+				Packages: []string{"-trimpath"},
+			},
+		},
+		{
+			"Run",
+			[]string{"run", "-race", ".", "-ldflags", "x"},
+			xgo.GoArgs{
+				Command:  "run",
+				Flags:    []xgo.GoFlag{{Name: "race", Value: "true"}},
+				Packages: []string{"."},
+				Tail:     []string{"-ldflags", "x"},
+			},
+		},
+		{
+			"Run files",
+			[]string{"run", "a.go", "b.go", "c"},
+			xgo.GoArgs{
+				Command:  "run",
+				Packages: []string{"a.go", "b.go"},
+				Tail:     []string{"c"},
+			},
+		},
+		{
+			"Test",
+			[]string{"test", "./...", "-run", "X", "-args", "-v"},
+			xgo.GoArgs{
+				Command:  "test",
+				Flags:    []xgo.GoFlag{{Name: "run", Value: "X"}},
+				Packages: []string{"./..."},
+				Tail:     []string{"-v"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var a xgo.GoArgs = xgo.ParseGoArgs(test.in, "")
+
+				assert.Equal(t, test.out, a)
+			},
+		)
+	}
+}
@@ -0,0 +1,340 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type fatArch struct {
+	Cpu    macho.Cpu
+	SubCpu uint32
+	Offset uint32
+	Size   uint32
+	Align  uint32
+}
+
+func alignUp(n uint32, align uint32) uint32 {
+	return (n + align - 1) &^ (align - 1)
+}
+
+func fatAlign(cpu macho.Cpu) uint32 {
+	// Match lipo: 16KiB pages for arm64, 4KiB otherwise
+	if cpu == macho.CpuArm64 {
+		return 14 //nolint:mnd // 2^14
+	}
+
+	return 12 //nolint:mnd // 2^12
+}
+
+// FindLipo will return the path to lipo (or llvm-lipo), if it is
+// installed.
+func FindLipo() (string, error) {
+	var e error
+	var lipo string
+
+	for _, name := range []string{"lipo", "llvm-lipo"} {
+		if lipo, e = exec.LookPath(name); e == nil {
+			return lipo, nil
+		}
+	}
+
+	return "", fmt.Errorf("lipo not found: %w", e)
+}
+
+// Lipo will merge the provided thin Mach-O binaries into a single
+// universal binary using lipo (or llvm-lipo). It returns the command
+// that was run.
+func Lipo(out string, inputs ...string) ([]string, error) {
+	var b []byte
+	var cmd []string
+	var e error
+	var lipo string
+
+	if lipo, e = FindLipo(); e != nil {
+		return nil, e
+	}
+
+	cmd = append([]string{lipo, "-create", "-output", out}, inputs...)
+
+	//nolint:gosec // G204 - That's kinda the point here
+	b, e = exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+	if e != nil {
+		if b = bytes.TrimSpace(b); len(b) > 0 {
+			return cmd, fmt.Errorf("%s", b)
+		}
+
+		return cmd, fmt.Errorf("failed to run lipo: %w", e)
+	}
+
+	return cmd, nil
+}
+
+// Return the lipo command for debug output. If lipo isn't installed,
+// the command is commented out, as the built-in implementation can't
+// be scripted.
+func lipoScript(shell string, out string, inputs []string) string {
+	var cmd string
+	var e error
+	var lipo string
+
+	if lipo, e = FindLipo(); e != nil {
+		lipo = "lipo"
+	}
+
+	cmd = strings.Join(
+		[]string{
+			strings.TrimSuffix(filepath.Base(lipo), ".exe"),
+			"-create -output",
+			quoteArg(shell, out),
+			quoteArg(shell, inputs[0]),
+			quoteArg(shell, inputs[1]),
+		},
+		" ",
+	)
+
+	if e != nil {
+		return comment(shell, "lipo not found, merge with: "+cmd)
+	}
+
+	return cmd
+}
+
+func validateUniversal(fn string, inputs ...string) error {
+	var cpus []macho.Cpu
+	var e error
+	var f *macho.File
+	var ff *macho.FatFile
+
+	for _, input := range inputs {
+		if f, e = macho.Open(input); e != nil {
+			return fmt.Errorf("%s is not a thin Mach-O: %w", input, e)
+		}
+
+		cpus = append(cpus, f.Cpu)
+		_ = f.Close()
+	}
+
+	if ff, e = macho.OpenFat(fn); e != nil {
+		return fmt.Errorf("%s is not a universal binary: %w", fn, e)
+	}
+	defer func() {
+		_ = ff.Close()
+	}()
+
+	if len(ff.Arches) != len(cpus) {
+		return fmt.Errorf(
+			"%s has %d architectures, expected %d",
+			fn,
+			len(ff.Arches),
+			len(cpus),
+		)
+	}
+
+	for _, arch := range ff.Arches {
+		if !slices.Contains(cpus, arch.Cpu) {
+			return fmt.Errorf("%s has unexpected %s", fn, arch.Cpu)
+		}
+	}
+
+	return nil
+}
+
+// WriteUniversal will merge the provided thin Mach-O binaries into a
+// single universal (fat) binary, without relying on lipo.
+func WriteUniversal(out string, inputs ...string) error {
+	var archs []fatArch
+	var data [][]byte
+	var e error
+	var f *macho.File
+	var fat bytes.Buffer
+	var offset uint32
+
+	for _, fn := range inputs {
+		var b []byte
+
+		if b, e = os.ReadFile(filepath.Clean(fn)); e != nil {
+			return fmt.Errorf("failed to read %s: %w", fn, e)
+		}
+
+		if f, e = macho.NewFile(bytes.NewReader(b)); e != nil {
+			return fmt.Errorf("%s is not a thin Mach-O: %w", fn, e)
+		}
+
+		archs = append(
+			archs,
+			fatArch{
+				Align:  fatAlign(f.Cpu),
+				Cpu:    f.Cpu,
+				Size:   uint32(len(b)), //nolint:gosec // G115 - <4GiB
+				SubCpu: f.SubCpu,
+			},
+		)
+		data = append(data, b)
+
+		_ = f.Close()
+	}
+
+	// Fat header and arch table, then each aligned thin binary
+	//nolint:gosec,mnd // G115 - header is 8 bytes, each arch is 20
+	offset = uint32(8 + 20*len(archs))
+
+	for i := range archs {
+		offset = alignUp(offset, 1<<archs[i].Align)
+		archs[i].Offset = offset
+		offset += archs[i].Size
+	}
+
+	//nolint:gosec // G115 - There are only ever a few archs
+	_ = binary.Write(
+		&fat,
+		binary.BigEndian,
+		[]uint32{macho.MagicFat, uint32(len(archs))},
+	)
+	_ = binary.Write(&fat, binary.BigEndian, archs)
+
+	for i, arch := range archs {
+		fat.Write(make([]byte, int(arch.Offset)-fat.Len()))
+		fat.Write(data[i])
+	}
+
+	//nolint:mnd // u=rwx,go=rx
+	if e = os.WriteFile(out, fat.Bytes(), 0o755); e != nil {
+		return fmt.Errorf("failed to write %s: %w", out, e)
+	}
+
+	return nil
+}
+
+// BuildUniversal will run the provided go build command for
+// darwin/amd64 and darwin/arm64, then merge the resulting binaries
+// into a single universal binary (named for "darwin/universal"). It
+// uses lipo, if available, otherwise it falls back to a built-in
+// implementation. The thin binaries are removed afterward.
+func (x *Compiler) BuildUniversal(
+	args ...string,
+) (*BuildResult, error) {
+	return x.BuildUniversalContext(context.Background(), args...)
+}
+
+// BuildUniversalContext is the same as BuildUniversal, but the go
+// commands and any processes they started will be killed if the
+// context is canceled.
+func (x *Compiler) BuildUniversalContext(
+	ctx context.Context,
+	args ...string,
+) (*BuildResult, error) {
+	var e error
+	var env map[string]string
+	var fn string
+	var inputs []string
+	var lipo string
+	var out string
+	var r *BuildResult = &BuildResult{
+		Target: Target{OS: "darwin", Arch: "universal"},
+	}
+	var start time.Time
+	var tr *BuildResult
+
+	// Resolve the output name with a darwin env, as the package may
+	// only build for darwin
+	env, e = x.SetupTargetEnvContext(
+		ctx,
+		Target{OS: "darwin", Arch: "amd64"},
+	)
+	if e != nil {
+		r.Error = e.Error()
+		return r, e
+	}
+
+	if out, e = x.Output(env, args...); e != nil {
+		r.Error = e.Error()
+		return r, e
+	} else if out == "" {
+		e = fmt.Errorf("universal binaries require a main package")
+		r.Error = e.Error()
+
+		return r, e
+	}
+
+	fn = r.Target.Output(out)
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		var t Target = Target{OS: "darwin", Arch: arch}
+
+		tr, e = x.BuildContext(
+			ctx,
+			t,
+			SetOutput(args, t.Output(out))...,
+		)
+		r.Duration += tr.Duration
+		r.Inputs = append(r.Inputs, tr)
+
+		if e != nil {
+			r.Error = e.Error()
+			r.ExitStatus = tr.ExitStatus
+
+			return r, e
+		}
+
+		inputs = append(inputs, t.Output(out))
+	}
+
+	if x.Debug {
+		lipo = lipoScript(defaultShell(x.Shell), fn, inputs)
+
+		// Thin build scripts were already streamed, if requested
+		if x.Stdout != nil {
+			_, e = fmt.Fprintln(x.Stdout, lipo)
+			return r, e //nolint:wrapcheck // Nothing to add
+		}
+
+		r.Stdout = strings.Join(
+			[]string{r.Inputs[0].Stdout, r.Inputs[1].Stdout, lipo},
+			"\n",
+		)
+
+		return r, nil
+	}
+
+	start = time.Now()
+
+	// Prefer lipo, but fall back to the built-in implementation if
+	// lipo is missing or fails (e.g. cctools lipo without arm64)
+	if r.Command, e = Lipo(fn, inputs...); e != nil {
+		r.Command = nil
+		e = WriteUniversal(fn, inputs...)
+	}
+
+	r.Duration += time.Since(start)
+
+	if e == nil {
+		e = validateUniversal(fn, inputs...)
+	}
+
+	for _, input := range inputs {
+		_ = os.Remove(input)
+	}
+
+	if e != nil {
+		r.Error = e.Error()
+		r.ExitStatus = -1
+
+		return r, e
+	}
+
+	if r.Artifact, e = NewArtifact(fn); e != nil {
+		r.Error = e.Error()
+		return r, e
+	}
+
+	return r, nil
+}
@@ -0,0 +1,131 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"debug/macho"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestBuildUniversal(t *testing.T) {
+	t.Parallel()
+
+	var dir string = t.TempDir()
+	var e error
+	var ff *macho.FatFile
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	r, e = x.BuildUniversal(
+		"build",
+		"-o",
+		filepath.Join(dir, "main"),
+		filepath.Join("testdata", "main.go"),
+	)
+	assert.NoError(t, e)
+	assert.Len(t, r.Inputs, 2)
+	assert.NotNil(t, r.Artifact)
+	assert.Equal(
+		t,
+		filepath.Join(dir, "main_darwin_universal"),
+		r.Artifact.Path,
+	)
+
+	// Thin binaries should be cleaned up
+	for _, in := range r.Inputs {
+		_, e = os.Stat(in.Artifact.Path)
+		assert.ErrorIs(t, e, os.ErrNotExist)
+	}
+
+	ff, e = macho.OpenFat(r.Artifact.Path)
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = ff.Close()
+	}()
+
+	assert.Len(t, ff.Arches, 2)
+}
+
+func TestBuildUniversalBrokenLipo(t *testing.T) {
+	var bin string = t.TempDir()
+	var dir string = t.TempDir()
+	var e error
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake lipo is a shell script")
+	}
+
+	// A lipo that always fails, like cctools lipo without arm64
+	e = os.WriteFile(
+		filepath.Join(bin, "lipo"),
+		[]byte("#!/bin/sh\nexit 1\n"),
+		0o700, //nolint:gosec // G306 - It needs to be executable
+	)
+	assert.NoError(t, e)
+
+	// Not parallel, as PATH is modified
+	t.Setenv(
+		"PATH",
+		bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+	)
+
+	r, e = x.BuildUniversal(
+		"build",
+		"-o",
+		filepath.Join(dir, "main"),
+		filepath.Join("testdata", "main.go"),
+	)
+	assert.NoError(t, e)
+	assert.Nil(t, r.Command)
+	assert.NotNil(t, r.Artifact)
+}
+
+func TestWriteUniversal(t *testing.T) {
+	t.Parallel()
+
+	var dir string = t.TempDir()
+	var e error
+	var ff *macho.FatFile
+	var fn string = filepath.Join(dir, "main")
+	var inputs []string
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		var tgt xgo.Target = xgo.Target{OS: "darwin", Arch: arch}
+
+		_, e = x.Build(
+			tgt,
+			"build",
+			"-o",
+			tgt.Output(fn),
+			filepath.Join("testdata", "main.go"),
+		)
+		assert.NoError(t, e)
+
+		inputs = append(inputs, tgt.Output(fn))
+	}
+
+	assert.NoError(t, xgo.WriteUniversal(fn, inputs...))
+
+	ff, e = macho.OpenFat(fn)
+	assert.NoError(t, e)
+
+	defer func() {
+		_ = ff.Close()
+	}()
+
+	assert.Len(t, ff.Arches, 2)
+	assert.Equal(t, macho.CpuAmd64, ff.Arches[0].Cpu)
+	assert.Equal(t, macho.CpuArm64, ff.Arches[1].Cpu)
+	assert.Zero(t, ff.Arches[1].Offset%(1<<14))
+
+	assert.Error(t, xgo.WriteUniversal(fn, "testdata/main.go"))
+}
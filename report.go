@@ -0,0 +1,54 @@
+package xgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Report is a struct containing the BuildResults for every Target
+// built during a single run.
+type Report struct {
+	Results []*BuildResult `json:"results"`
+	Version string         `json:"version"`
+}
+
+// NewReport will return a new Report for the provided BuildResults.
+func NewReport(results ...*BuildResult) *Report {
+	return &Report{Results: results, Version: Version}
+}
+
+// ReadReport will read a JSON Report from the provided file.
+func ReadReport(fn string) (*Report, error) {
+	var b []byte
+	var e error
+	var r *Report = &Report{}
+
+	if b, e = os.ReadFile(filepath.Clean(fn)); e != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fn, e)
+	}
+
+	if e = json.Unmarshal(b, r); e != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fn, e)
+	}
+
+	return r, nil
+}
+
+// Write will write the Report as JSON to the provided file.
+func (r *Report) Write(fn string) error {
+	var b []byte
+	var e error
+
+	if b, e = json.MarshalIndent(r, "", "  "); e != nil {
+		return fmt.Errorf("failed to marshal report: %w", e)
+	}
+
+	//nolint:mnd // u=rw,go=r
+	if e = os.WriteFile(fn, append(b, '\n'), 0o644); e != nil {
+		return fmt.Errorf("failed to write %s: %w", fn, e)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// section is a named range of a binary.
+type section struct {
+	name   string
+	offset uint64
+	size   uint64
+}
+
+// Return the first difference between two binaries, described by the
+// section containing it, if the format is known
+func firstDiff(a []byte, b []byte) string {
+	var i int
+	var n int = min(len(a), len(b))
+
+	for i < n && (a[i] == b[i]) {
+		i++
+	}
+
+	if i == n {
+		return fmt.Sprintf("sizes differ (%d != %d)", len(a), len(b))
+	}
+
+	for _, s := range sections(a) {
+		if (uint64(i) >= s.offset) && (uint64(i) < s.offset+s.size) {
+			return fmt.Sprintf(
+				"first difference in %s at offset %#x",
+				s.name,
+				i,
+			)
+		}
+	}
+
+	return fmt.Sprintf("first difference at offset %#x", i)
+}
+
+// Return whether the env var matches a keepEnv entry, which may be a
+// prefix ending in "*"
+func keepVar(k string) func(string) bool {
+	return func(keep string) bool {
+		var ok bool
+
+		// Windows env vars aren't case-sensitive
+		if keep, ok = strings.CutSuffix(keep, "*"); ok {
+			return (len(k) >= len(keep)) &&
+				strings.EqualFold(k[:len(keep)], keep)
+		}
+
+		return strings.EqualFold(k, keep)
+	}
+}
+
+// Return only the env vars in keepEnv, with SOURCE_DATE_EPOCH pinned
+func reproducibleEnv(env map[string]string) map[string]string {
+	var tmp map[string]string = map[string]string{}
+
+	for k, v := range env {
+		if slices.ContainsFunc(keepEnv, keepVar(k)) {
+			tmp[k] = v
+		}
+	}
+
+	// Pin the time used by C compilers and archives
+	if tmp["SOURCE_DATE_EPOCH"] == "" {
+		tmp["SOURCE_DATE_EPOCH"] = strconv.FormatInt(
+			SourceDateEpoch().Unix(),
+			10,
+		)
+	}
+
+	return tmp
+}
+
+// Return the file-backed sections of an ELF, Mach-O, or PE binary
+func sections(b []byte) []section {
+	var r *bytes.Reader = bytes.NewReader(b)
+	var tmp []section
+
+	if f, e := elf.NewFile(r); e == nil {
+		for _, s := range f.Sections {
+			if s.Type != elf.SHT_NOBITS {
+				tmp = append(tmp, section{s.Name, s.Offset, s.Size})
+			}
+		}
+
+		return tmp
+	}
+
+	if f, e := macho.NewFile(r); e == nil {
+		for _, s := range f.Sections {
+			tmp = append(
+				tmp,
+				section{
+					s.Seg + "," + s.Name,
+					uint64(s.Offset),
+					s.Size,
+				},
+			)
+		}
+
+		return tmp
+	}
+
+	if f, e := pe.NewFile(r); e == nil {
+		for _, s := range f.Sections {
+			tmp = append(
+				tmp,
+				section{s.Name, uint64(s.Offset), uint64(s.Size)},
+			)
+		}
+
+		return tmp
+	}
+
+	return nil
+}
+
+// Return a copy of env with a new, empty GOCACHE, which the caller
+// should remove
+func tempCache(env map[string]string) (map[string]string, error) {
+	var dir string
+	var e error
+
+	if dir, e = os.MkdirTemp("", "xgo-gocache-"); e != nil {
+		return nil, fmt.Errorf("failed to create GOCACHE: %w", e)
+	}
+
+	env = maps.Clone(env)
+	env["GOCACHE"] = dir
+
+	return env, nil
+}
+
+// Rebuild the artifact with a separate GOCACHE and compare it to the
+// original
+func (x *Compiler) verify(
+	ctx context.Context,
+	env map[string]string,
+	args []string,
+	out string,
+) error {
+	var a []byte
+	var b []byte
+	var dir string
+	var e error
+	var fn string
+
+	if env, e = tempCache(env); e != nil {
+		return e
+	}
+	defer func() {
+		_ = os.RemoveAll(env["GOCACHE"])
+	}()
+
+	if dir, e = os.MkdirTemp("", "xgo-verify-"); e != nil {
+		return fmt.Errorf("failed to create temp dir: %w", e)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	// Same filename, as darwin signatures include it
+	fn = filepath.Join(dir, filepath.Base(out))
+
+	_, e = x.run(ctx, env, SetOutput(args, fn), nil, nil, x.Stderr)
+	if e != nil {
+		return e
+	}
+
+	if a, e = os.ReadFile(filepath.Clean(out)); e != nil {
+		return fmt.Errorf("failed to read %s: %w", out, e)
+	}
+
+	if b, e = os.ReadFile(filepath.Clean(fn)); e != nil {
+		return fmt.Errorf("failed to read %s: %w", fn, e)
+	}
+
+	if !bytes.Equal(a, b) {
+		return fmt.Errorf(
+			"%s is not reproducible: %s",
+			out,
+			firstDiff(a, b),
+		)
+	}
+
+	return nil
+}
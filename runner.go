@@ -0,0 +1,183 @@
+package xgo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// ErrNoRunner is returned when a Target's binaries can't run on the
+// host, and no runner (e.g. qemu or wine) was found for it.
+var ErrNoRunner = errors.New("no runner")
+
+// runner is a command that can run binaries for another target.
+type runner struct {
+	cmd     []string // Env vars (e.g. ${GOROOT}) are expanded
+	need    string   // Must be in PATH, if cmd[0] isn't enough
+	sysroot string   // For qemu -L, if it exists
+}
+
+// Return true if the host can run binaries for the Target natively
+func canRun(t Target) bool {
+	var host Target = HostTarget()
+
+	switch {
+	case (t.Arch == "universal") && (host.OS == "darwin"):
+		return true
+	case t.OS != host.OS:
+		return false
+	case t.Arch == host.Arch:
+		return true
+	case (host.Arch == "amd64") && (t.Arch == "386"):
+		// Except for darwin, which dropped 32-bit support
+		return t.OS != "darwin"
+	case (host.Arch == "arm64") && (t.OS == "windows"):
+		// Windows on ARM emulates x86
+		return (t.Arch == "386") || (t.Arch == "amd64")
+	}
+
+	return false
+}
+
+// Return the qemu-user runners (static first) for a Linux target,
+// with the sysroot for dynamically linked (CGO) binaries
+func qemu(arch string, sysroot string) []runner {
+	return []runner{
+		{
+			cmd:     []string{"qemu-" + arch + "-static"},
+			sysroot: sysroot,
+		},
+		{cmd: []string{"qemu-" + arch}, sysroot: sysroot},
+	}
+}
+
+// Return the runner's command, quoted for go test -exec, if it's
+// available
+func (r runner) command(env map[string]string) (string, bool) {
+	var args []string
+	var lookup func(string) string = func(k string) string {
+		if v, ok := env[k]; ok {
+			return v
+		}
+
+		return os.Getenv(k)
+	}
+
+	for _, arg := range r.cmd {
+		args = append(args, goQuote(os.Expand(arg, lookup)))
+	}
+
+	if _, e := exec.LookPath(os.Expand(r.cmd[0], lookup)); e != nil {
+		return "", false
+	}
+
+	if r.need != "" {
+		if _, e := exec.LookPath(r.need); e != nil {
+			return "", false
+		}
+	}
+
+	if (r.sysroot != "") && isDir("/usr/"+r.sysroot) {
+		args = slices.Insert(args, 1, "-L", "/usr/"+r.sysroot)
+	}
+
+	return strings.Join(args, " "), true
+}
+
+// Runner will return the command (e.g. "qemu-aarch64-static -L
+// /usr/aarch64-linux-gnu" or "wine64") to run the Target's binaries,
+// for go test -exec, using env (e.g. from SetupTargetEnv) to expand
+// any env vars (e.g. ${GOROOT}). Runners (by "os/arch[/variant]" or
+// "os/arch") take precedence over the defaults, and an empty runner
+// means the host can run the binaries as is (e.g. with binfmt_misc).
+// If the host can run the Target's binaries natively, Runner will
+// return an empty string. If no runner is found, the error wraps
+// ErrNoRunner.
+func (x *Compiler) Runner(
+	t Target,
+	env map[string]string,
+) (string, error) {
+	var keys []string
+	var need []string
+
+	for _, key := range variantKeys(t) {
+		keys = append(keys, t.OS+"/"+key)
+	}
+
+	for _, key := range keys {
+		if cmd, ok := x.Runners[key]; ok {
+			return cmd, nil
+		}
+	}
+
+	if canRun(t) {
+		return "", nil
+	}
+
+	for _, key := range keys {
+		for _, r := range runners[key] {
+			if cmd, ok := r.command(env); ok {
+				return cmd, nil
+			}
+
+			if r.need == "" {
+				need = append(need, r.cmd[0])
+			} else if !slices.Contains(need, r.need) {
+				need = append(need, r.need)
+			}
+		}
+
+		if len(runners[key]) > 0 {
+			break
+		}
+	}
+
+	if len(need) == 0 {
+		return "", fmt.Errorf("%w for %s", ErrNoRunner, t)
+	}
+
+	return "", fmt.Errorf(
+		"%w for %s (install %s)",
+		ErrNoRunner,
+		t,
+		strings.Join(need, " or "),
+	)
+}
+
+// RunnerArgs will return a copy of the provided go command args with
+// -exec set to the Target's runner (see Runner), for go test. The
+// args are returned as is for other go commands, if -exec or -c were
+// already provided, or if no runner is needed.
+func (x *Compiler) RunnerArgs(
+	t Target,
+	env map[string]string,
+	args []string,
+) ([]string, error) {
+	var a GoArgs
+	var cmd string
+	var e error
+
+	if (len(args) == 0) || (args[0] != "test") {
+		return args, nil
+	}
+
+	a = ParseGoArgs(args, env["GOFLAGS"])
+	if _, ok := a.Flag("exec"); ok {
+		return args, nil
+	} else if _, ok := a.Flag("c"); ok {
+		return args, nil
+	}
+
+	if cmd, e = x.Runner(t, env); (e != nil) || (cmd == "") {
+		return args, e
+	}
+
+	return slices.Concat(
+		args[:1],
+		[]string{"--exec=" + cmd},
+		args[1:],
+	), nil
+}
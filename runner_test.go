@@ -0,0 +1,103 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+type runnerTest struct {
+	name   string
+	target string
+	in     []string
+	out    []string
+}
+
+func TestRunner(t *testing.T) {
+	t.Parallel()
+
+	var cmd string
+	var e error
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	// The host never needs a runner
+	cmd, e = x.Runner(xgo.HostTarget(), nil)
+	assert.NoError(t, e)
+	assert.Empty(t, cmd)
+
+	_, e = x.Runner(xgo.Target{OS: "plan9", Arch: "arm"}, nil)
+	assert.ErrorIs(t, e, xgo.ErrNoRunner)
+}
+
+func TestRunnerArgs(t *testing.T) {
+	t.Parallel()
+
+	var tests []runnerTest = []runnerTest{
+		{
+			"Build",
+			"linux/arm64",
+			[]string{"build", "."},
+			[]string{"build", "."},
+		},
+		{
+			"Test",
+			"linux/arm64",
+			[]string{"test", "-v", "."},
+			[]string{"test", "--exec=qemu-aarch64", "-v", "."},
+		},
+		{
+			"Variant",
+			"linux/arm/5",
+			[]string{"test", "."},
+			[]string{"test", "--exec=qemu-arm -L '/x y'", "."},
+		},
+		{
+			"Exec",
+			"linux/arm64",
+			[]string{"test", "-exec", "echo", "."},
+			[]string{"test", "-exec", "echo", "."},
+		},
+		{
+			"Compile",
+			"linux/arm64",
+			[]string{"test", "-c", "."},
+			[]string{"test", "-c", "."},
+		},
+		{
+			"Binfmt",
+			"linux/riscv64",
+			[]string{"test", "."},
+			[]string{"test", "."},
+		},
+	}
+	var x *xgo.Compiler = &xgo.Compiler{
+		Runners: map[string]string{
+			"linux/arm":     "qemu-arm",
+			"linux/arm/5":   "qemu-arm -L '/x y'",
+			"linux/arm64":   "qemu-aarch64",
+			"linux/riscv64": "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var args []string
+				var e error
+				var tgt xgo.Target
+
+				tgt, e = xgo.ParseTarget(test.target)
+				assert.NoError(t, e)
+
+				args, e = x.RunnerArgs(tgt, nil, test.in)
+				assert.NoError(t, e)
+				assert.Equal(t, test.out, args)
+			},
+		)
+	}
+}
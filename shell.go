@@ -0,0 +1,194 @@
+package xgo
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// cmdSpecial is the list of characters cmd will interpret, unless
+// they are escaped with a caret.
+const cmdSpecial string = "^&|<>()!\""
+
+// safeArg matches args that don't need quoting, per shell.
+var safeArg = map[string]*regexp.Regexp{
+	"cmd":        regexp.MustCompile(`^[A-Za-z0-9_@+=:,./\\-]+$`),
+	"fish":       regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]+$`),
+	"powershell": regexp.MustCompile(`^[A-Za-z0-9_+=:./-]+$`),
+	"sh": regexp.MustCompile(
+		`^[A-Za-z0-9_@%+:,./-][A-Za-z0-9_@%+=:,./-]*$`,
+	),
+}
+
+// safeFlag matches the name of a flag with a value (e.g. --ldflags=),
+// so that only the value needs quoting.
+var safeFlag *regexp.Regexp = regexp.MustCompile(
+	`^--?[A-Za-z0-9_.-]+=`,
+)
+
+func caretEscape(s string) string {
+	var sb strings.Builder
+
+	for _, c := range s {
+		switch {
+		case c == '%':
+			// Carets don't work for %, but batch files unescape %%
+			sb.WriteString("%%")
+			continue
+		case strings.ContainsRune(cmdSpecial, c):
+			sb.WriteRune('^')
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+func checkShell(shell string, values ...string) error {
+	if _, ok := safeArg[shell]; !ok {
+		return fmt.Errorf("unsupported shell %s", shell)
+	}
+
+	if shell != "cmd" {
+		return nil
+	}
+
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("%q can't contain a newline in cmd", v)
+		}
+	}
+
+	return nil
+}
+
+// Return the provided text as a comment for the provided shell
+func comment(shell string, text string) string {
+	if shell == "cmd" {
+		return "REM " + text
+	}
+
+	return "# " + text
+}
+
+func defaultShell(shell string) string {
+	switch {
+	case shell != "":
+		return shell
+	case runtime.GOOS == "windows":
+		return "powershell"
+	default:
+		return "sh"
+	}
+}
+
+// Quote will return the provided arg, quoted if needed, for the
+// provided shell (sh, fish, powershell, or cmd). If shell is empty,
+// it defaults to powershell on Windows and sh everywhere else.
+// Unsupported shells are treated as sh.
+func Quote(shell string, arg string) string {
+	if _, ok := safeArg[defaultShell(shell)]; !ok {
+		shell = "sh"
+	}
+
+	return quoteArg(defaultShell(shell), arg)
+}
+
+func quoteArg(shell string, arg string) string {
+	var flag string
+
+	if safeArg[shell].MatchString(arg) {
+		return arg
+	}
+
+	// Quote only the value of --flag=value, for readability, except
+	// in PowerShell, which is inconsistent with partially quoted args
+	if shell != "powershell" {
+		flag = safeFlag.FindString(arg)
+		arg = strings.TrimPrefix(arg, flag)
+	}
+
+	switch shell {
+	case "cmd":
+		return flag + caretEscape(quoteArgv(arg))
+	case "fish":
+		return flag + quoteFish(arg)
+	case "powershell":
+		return quotePowerShell(arg)
+	default:
+		return flag + quoteSh(arg)
+	}
+}
+
+func quoteArgv(arg string) string {
+	var backslashes int
+	var sb strings.Builder
+
+	if (arg != "") && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+
+	// Windows (CommandLineToArgvW) rules: backslashes are only
+	// special before a double quote
+	sb.WriteString("\"")
+
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// Escape the backslashes and the quote
+			sb.WriteString(strings.Repeat("\\", 2*backslashes+1))
+		default:
+			sb.WriteString(strings.Repeat("\\", backslashes))
+		}
+
+		backslashes = 0
+
+		sb.WriteRune(c)
+	}
+
+	// Escape trailing backslashes, as they precede the closing quote
+	sb.WriteString(strings.Repeat("\\", 2*backslashes) + "\"")
+
+	return sb.String()
+}
+
+func quoteEnv(shell string, k string, v string) string {
+	switch shell {
+	case "cmd":
+		return "set " + k + "=" + caretEscape(v)
+	case "fish":
+		return "set -gx " + k + " " + quoteFish(v)
+	case "powershell":
+		return "$env:" + k + " = " + quotePowerShell(v)
+	default:
+		return "export " + k + "=" + quoteSh(v)
+	}
+}
+
+func quoteFish(v string) string {
+	return "'" + strings.NewReplacer(
+		"\\", "\\\\",
+		"'", "\\'",
+	).Replace(v) + "'"
+}
+
+func quotePowerShell(v string) string {
+	// Single quotes are literal, except for embedded single quotes
+	// (including the "smart" variants PowerShell also accepts)
+	return "'" + strings.NewReplacer(
+		"'", "''",
+		"‘", "‘‘",
+		"’", "’’",
+		"‚", "‚‚",
+		"‛", "‛‛",
+	).Replace(v) + "'"
+}
+
+func quoteSh(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
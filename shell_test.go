@@ -0,0 +1,349 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+var envAssign *regexp.Regexp = regexp.MustCompile(`^[A-Za-z_]+=`)
+
+var tricky []string = []string{
+	"",
+	"plain",
+	"a b",
+	"$HOME",
+	"`id`",
+	"$(id)",
+	"\"q\"",
+	"it's",
+	"it’s",
+	"a\\",
+	"a\\\\\"b",
+	"\\\"",
+	"%PATH%",
+	"!x!",
+	"^&|<>()",
+	"=start",
+	"-X main.v=\"a b\"",
+	"--ldflags=-s -w",
+	"--ldflags=-X 'main.v=$x'",
+	"*?[a]{b,c}~#;",
+	"@splat,comma",
+}
+
+// Parse cmd output: carets escape the next char and %% is %, then
+// args are split using Windows (CommandLineToArgvW) rules
+func parseCmd(script string) (map[string]string, []string) {
+	var env map[string]string = map[string]string{}
+	var lines []string = strings.Split(unescapeCmd(script), "\n")
+
+	for _, line := range lines[:len(lines)-1] {
+		k, v, _ := strings.Cut(strings.TrimPrefix(line, "set "), "=")
+		env[k] = v
+	}
+
+	return env, splitArgv(lines[len(lines)-1])
+}
+
+// Parse PowerShell output: $env:NAME = 'value' statements, then the
+// command, using single-quoted strings with doubled quotes
+func parsePowerShell(script string) (map[string]string, []string) {
+	var env map[string]string = map[string]string{}
+	var words []string = splitWords(script, "powershell")
+
+	for (len(words) > 2) && strings.HasPrefix(words[0], "$env:") {
+		env[strings.TrimPrefix(words[0], "$env:")] = words[2]
+		words = words[3:]
+	}
+
+	return env, words
+}
+
+// Parse sh or fish output: leading NAME=value words are env
+func parseSh(
+	script string,
+	shell string,
+) (map[string]string, []string) {
+	var env map[string]string = map[string]string{}
+	var words []string = splitWords(script, shell)
+
+	for (len(words) > 0) && envAssign.MatchString(words[0]) {
+		k, v, _ := strings.Cut(words[0], "=")
+		env[k] = v
+		words = words[1:]
+	}
+
+	return env, words
+}
+
+func splitArgv(line string) []string {
+	var arg strings.Builder
+	var args []string
+	var backslashes int
+	var inArg bool
+	var quoted bool
+
+	for _, c := range line {
+		switch {
+		case c == '\\':
+			backslashes++
+			inArg = true
+
+			continue
+		case c == '"':
+			arg.WriteString(strings.Repeat("\\", backslashes/2))
+
+			if backslashes%2 == 1 {
+				arg.WriteRune('"')
+			} else {
+				quoted = !quoted
+			}
+
+			backslashes = 0
+			inArg = true
+
+			continue
+		}
+
+		arg.WriteString(strings.Repeat("\\", backslashes))
+		backslashes = 0
+
+		if (c == ' ') && !quoted {
+			if inArg {
+				args = append(args, arg.String())
+			}
+
+			arg.Reset()
+			inArg = false
+
+			continue
+		}
+
+		arg.WriteRune(c)
+		inArg = true
+	}
+
+	arg.WriteString(strings.Repeat("\\", backslashes))
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args
+}
+
+//nolint:gocognit // Simple state machine for 3 quoting styles
+func splitWords(line string, shell string) []string {
+	var escaped bool
+	var quote rune
+	var runes []rune = []rune(line)
+	var word strings.Builder
+	var words []string
+	var inWord bool
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case escaped:
+			// Line continuation
+			if c != '\n' {
+				word.WriteRune(c)
+			}
+
+			escaped = false
+		case (quote != 0) && (shell == "powershell"):
+			if strings.ContainsRune("'‘’‚‛", c) {
+				if (i+1 < len(runes)) && (runes[i+1] == c) {
+					word.WriteRune(c)
+					i++
+				} else {
+					quote = 0
+				}
+			} else {
+				word.WriteRune(c)
+			}
+		case (quote != 0) && (shell == "fish"):
+			switch {
+			case c == '\\' && (i+1 < len(runes)) &&
+				strings.ContainsRune("\\'", runes[i+1]):
+				word.WriteRune(runes[i+1])
+				i++
+			case c == '\'':
+				quote = 0
+			default:
+				word.WriteRune(c)
+			}
+		case quote != 0:
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case c == '\'':
+			quote = c
+			inWord = true
+		case (c == ' ') || (c == '\n'):
+			if inWord {
+				words = append(words, word.String())
+			}
+
+			word.Reset()
+			inWord = false
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+func unescapeCmd(s string) string {
+	var escaped bool
+	var sb strings.Builder
+
+	s = strings.ReplaceAll(s, "%%", "%")
+
+	for _, c := range s {
+		if !escaped && (c == '^') {
+			escaped = true
+			continue
+		}
+
+		escaped = false
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+func TestQuote(t *testing.T) {
+	t.Parallel()
+
+	var tests map[string][]string = map[string][]string{
+		"cmd":        {"a b", `^"a b^"`},
+		"fish":       {"it's", `'it\'s'`},
+		"powershell": {"it's", "'it''s'"},
+		"sh":         {"it's", `'it'\''s'`},
+		"zsh":        {"it's", `'it'\''s'`},
+	}
+
+	for shell, test := range tests {
+		assert.Equal(t, test[1], xgo.Quote(shell, test[0]))
+		assert.Equal(t, "plain", xgo.Quote(shell, "plain"))
+	}
+}
+
+func TestShellQuoting(t *testing.T) {
+	var shells []string = []string{"cmd", "fish", "powershell", "sh"}
+
+	t.Parallel()
+
+	for _, shell := range shells {
+		t.Run(
+			shell,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var actual []string
+				var args []string = slices.Concat(
+					[]string{"build"},
+					tricky,
+				)
+				var e error
+				var env map[string]string
+				var script string
+				var x *xgo.Compiler = &xgo.Compiler{
+					Debug:    true,
+					DebugEnv: []string{"CC"},
+					Shell:    shell,
+				}
+
+				// cmd can't represent newlines at all
+				if shell != "cmd" {
+					args = append(args, "multi\nline")
+				} else {
+					_, e = x.Run(nil, "build", "multi\nline")
+					assert.Error(t, e)
+				}
+
+				for _, v := range args {
+					script, e = x.Run(
+						map[string]string{"CC": v},
+						args...,
+					)
+					assert.NoError(t, e)
+
+					switch shell {
+					case "cmd":
+						env, actual = parseCmd(script)
+					case "powershell":
+						env, actual = parsePowerShell(script)
+					default:
+						env, actual = parseSh(script, shell)
+					}
+
+					assert.Equal(t, map[string]string{"CC": v}, env)
+					assert.Equal(
+						t,
+						slices.Concat([]string{"go"}, args),
+						actual,
+					)
+				}
+			},
+		)
+	}
+}
+
+func TestShellQuotingSh(t *testing.T) {
+	t.Parallel()
+
+	var args []string = slices.Concat(tricky, []string{"multi\nline"})
+	var b []byte
+	var e error
+	var script string
+	var sh string
+	var x *xgo.Compiler = &xgo.Compiler{
+		Debug:    true,
+		DebugEnv: []string{"CC"},
+		Shell:    "sh",
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not expected on windows")
+	}
+
+	if sh, e = exec.LookPath("sh"); e != nil {
+		t.Skip("sh not found")
+	}
+
+	script, e = x.Run(map[string]string{"CC": "$HOME `id`"}, args...)
+	assert.NoError(t, e)
+
+	// Replace go with a function that prints CC and its args
+	script = "go() { printf '%s\\0' \"$CC\" \"$@\"; }\n" + script
+
+	b, e = exec.Command(sh, "-c", script).Output()
+	assert.NoError(t, e)
+	assert.Equal(
+		t,
+		slices.Concat([]string{"$HOME `id`"}, args),
+		strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00"),
+	)
+}
@@ -0,0 +1,175 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SmokeResult is a struct containing the results of running a build
+// artifact (see Compiler.Smoke).
+type SmokeResult struct {
+	Command    []string      `json:"command,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+	Error      string        `json:"error,omitempty"`
+	ExitStatus int           `json:"exit_status"`
+	Output     []string      `json:"output,omitempty"` // First lines
+	Skipped    bool          `json:"skipped,omitempty"`
+}
+
+// headWriter keeps only the first lines written to it, up to a byte
+// limit, in case the output has no newlines.
+type headWriter struct {
+	b     bytes.Buffer
+	bytes int
+	lines int
+}
+
+// Write will keep p, up to the line and byte limits, and always
+// succeeds.
+func (w *headWriter) Write(p []byte) (int, error) {
+	var i int
+	var n int = len(p)
+
+	for (len(p) > 0) && (w.lines > 0) && (w.bytes > 0) {
+		if i = bytes.IndexByte(p, '\n'); i < 0 {
+			i = len(p) - 1
+		} else {
+			w.lines--
+		}
+
+		i = min(i+1, w.bytes)
+		w.b.Write(p[:i])
+		w.bytes -= i
+		p = p[i:]
+	}
+
+	return n, nil
+}
+
+// Smoke will run the BuildResult's artifact with the provided args,
+// through the Target's runner (see Runner), if needed, and store a
+// SmokeResult in the BuildResult. The artifact is killed if it runs
+// longer than the provided timeout. An error is returned if it
+// couldn't run, timed out, or exited with a non-zero status. If no
+// runner was found, the SmokeResult is marked as skipped and the
+// error wraps ErrNoRunner.
+func (x *Compiler) Smoke(
+	r *BuildResult,
+	timeout time.Duration,
+	args ...string,
+) error {
+	return x.SmokeContext(context.Background(), r, timeout, args...)
+}
+
+// SmokeContext is the same as Smoke, but the artifact (and any
+// runner) will also be killed if the context is canceled.
+func (x *Compiler) SmokeContext(
+	ctx context.Context,
+	r *BuildResult,
+	timeout time.Duration,
+	args ...string,
+) error {
+	var cancel context.CancelFunc
+	var cmd *exec.Cmd
+	var e error
+	var env map[string]string
+	var fn string
+	var out headWriter = headWriter{
+		bytes: smokeBytes,
+		lines: smokeLines,
+	}
+	var runner string
+	var s *SmokeResult = &SmokeResult{ExitStatus: -1}
+	var start time.Time
+
+	r.Smoke = s
+
+	if r.Artifact == nil {
+		e = errors.New("no artifact to run")
+		s.Error = e.Error()
+
+		return e
+	}
+
+	// Relative paths would be looked up in PATH
+	if fn, e = filepath.Abs(r.Artifact.Path); e != nil {
+		e = fmt.Errorf("failed to resolve %s: %w", r.Artifact.Path, e)
+		s.Error = e.Error()
+
+		return e
+	}
+
+	// Only needed to expand runners (e.g. ${GOROOT})
+	if r.Target.Arch != "universal" {
+		if env, e = x.SetupTargetEnvContext(ctx, r.Target); e != nil {
+			s.Error = e.Error()
+			return e
+		}
+	}
+
+	if runner, e = x.Runner(r.Target, env); e != nil {
+		s.Error = e.Error()
+		s.Skipped = true
+
+		return e
+	}
+
+	s.Command = append(splitQuoted(runner), fn)
+	s.Command = append(s.Command, args...)
+
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	//nolint:gosec // G204 - That's kinda the point here
+	cmd = exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stderr = &out
+	cmd.Stdout = &out
+	cmd.WaitDelay = time.Second
+
+	// Wine is very noisy, otherwise
+	if os.Getenv("WINEDEBUG") == "" {
+		cmd.Env = append(os.Environ(), "WINEDEBUG=-all")
+	}
+
+	setProcessGroup(cmd)
+
+	start = time.Now()
+	e = cmd.Run()
+	s.Duration = time.Since(start)
+
+	if o := strings.TrimRight(out.b.String(), "\n"); o != "" {
+		s.Output = strings.Split(o, "\n")
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		e = fmt.Errorf("%s timed out after %s", fn, timeout)
+	case ctx.Err() != nil:
+		e = fmt.Errorf("%s: %w", fn, ctx.Err())
+	case e == nil:
+		s.ExitStatus = 0
+		return nil
+	default:
+		if xe, ok := e.(*exec.ExitError); ok {
+			s.ExitStatus = xe.ExitCode()
+			e = fmt.Errorf(
+				"%s exited with status %d",
+				fn,
+				s.ExitStatus,
+			)
+		} else {
+			e = fmt.Errorf("failed to run %s: %w", fn, e)
+		}
+	}
+
+	s.Error = e.Error()
+
+	return e
+}
@@ -0,0 +1,78 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestSmoke(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var fn string = filepath.Join(t.TempDir(), "main")
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	r, e = x.Build(
+		xgo.HostTarget(),
+		"build",
+		"-o",
+		fn,
+		filepath.Join("testdata", "main.go"),
+	)
+	assert.NoError(t, e)
+
+	assert.NoError(t, x.Smoke(r, time.Minute, "--version"))
+	assert.NotNil(t, r.Smoke)
+	assert.Equal(t, 0, r.Smoke.ExitStatus)
+	assert.Equal(t, []string{fn, "--version"}, r.Smoke.Command)
+	assert.Equal(t, []string{"hello from Go"}, r.Smoke.Output)
+
+	// Nothing to run
+	r = &xgo.BuildResult{Target: xgo.HostTarget()}
+	assert.Error(t, x.Smoke(r, time.Minute))
+	assert.NotNil(t, r.Smoke)
+	assert.NotEmpty(t, r.Smoke.Error)
+}
+
+func TestSmokeNoNewlines(t *testing.T) {
+	t.Parallel()
+
+	var dir string = t.TempDir()
+	var e error
+	var r *xgo.BuildResult
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	e = os.WriteFile(
+		filepath.Join(dir, "main.go"),
+		[]byte(
+			"package main\n\nimport (\n\"os\"\n\"strings\"\n)\n\n"+
+				"func main() {\n"+
+				"x := strings.Repeat(\"x\", 1<<20)\n"+
+				"os.Stdout.WriteString(x)\n}\n",
+		),
+		0o600,
+	)
+	assert.NoError(t, e)
+
+	r, e = x.Build(
+		xgo.HostTarget(),
+		"build",
+		"-o",
+		filepath.Join(dir, "main"),
+		filepath.Join(dir, "main.go"),
+	)
+	assert.NoError(t, e)
+
+	// Output is capped by bytes, not just lines
+	assert.NoError(t, x.Smoke(r, time.Minute))
+	assert.Len(t, r.Smoke.Output, 1)
+	assert.Less(t, len(strings.Join(r.Smoke.Output, "")), 1<<20)
+}
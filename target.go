@@ -0,0 +1,166 @@
+package xgo
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Target is a struct containing the GOOS, GOARCH, and optional
+// architecture variant (GOARM, GOAMD64, GO386, GOMIPS, etc.) to
+// compile for.
+type Target struct {
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	Variant string `json:"variant,omitempty"`
+}
+
+type variant struct {
+	env    string
+	opts   []string
+	values []string
+}
+
+// HostTarget will return the Target for the current host.
+func HostTarget() Target {
+	return Target{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// ParseTarget will parse a target spec of the form
+// "os/arch[/variant]" (e.g. "linux/arm/7", "linux/amd64/v3", or
+// "linux/mips/softfloat").
+func ParseTarget(spec string) (Target, error) {
+	var e error
+	var parts []string = strings.Split(strings.TrimSpace(spec), "/")
+	var t Target
+
+	switch len(parts) {
+	case 2: //nolint:mnd // os/arch
+		t = Target{OS: parts[0], Arch: parts[1]}
+	case 3: //nolint:mnd // os/arch/variant
+		t = Target{OS: parts[0], Arch: parts[1], Variant: parts[2]}
+	default:
+		return t, fmt.Errorf("invalid target %q", spec)
+	}
+
+	if (t.OS == "") || (t.Arch == "") {
+		return t, fmt.Errorf("invalid target %q", spec)
+	}
+
+	if t.Variant, e = normalizeVariant(t.Arch, t.Variant); e != nil {
+		return t, e
+	}
+
+	return t, nil
+}
+
+// TargetFromEnv will return the Target described by the provided
+// env. Missing GOOS/GOARCH values default to the host.
+func TargetFromEnv(env map[string]string) Target {
+	var t Target = Target{OS: env["GOOS"], Arch: env["GOARCH"]}
+
+	if t.OS == "" {
+		t.OS = runtime.GOOS
+	}
+
+	if t.Arch == "" {
+		t.Arch = runtime.GOARCH
+	}
+
+	if v, ok := variants[t.Arch]; ok {
+		t.Variant = env[v.env]
+	}
+
+	return t
+}
+
+func normalizeVariant(goarch string, spec string) (string, error) {
+	var base string
+	var opts []string
+	var v variant
+
+	if spec == "" {
+		return "", nil
+	}
+
+	if _, ok := variants[goarch]; !ok {
+		return "", fmt.Errorf("%s does not support variants", goarch)
+	}
+
+	v = variants[goarch]
+	opts = strings.Split(spec, ",")
+	base = opts[0]
+
+	switch goarch {
+	case "amd64":
+		// Allow "3" as shorthand for "v3"
+		if !strings.HasPrefix(base, "v") {
+			base = "v" + base
+		}
+	case "arm":
+		// Allow "v7" as shorthand for "7"
+		base = strings.TrimPrefix(base, "v")
+	}
+
+	if !slices.Contains(v.values, base) {
+		return "", fmt.Errorf(
+			"invalid %s variant %q (%s)",
+			goarch,
+			spec,
+			strings.Join(v.values, ", "),
+		)
+	}
+
+	for _, opt := range opts[1:] {
+		if !slices.Contains(v.opts, opt) {
+			return "", fmt.Errorf(
+				"invalid %s variant option %q",
+				goarch,
+				opt,
+			)
+		}
+	}
+
+	return strings.Join(append([]string{base}, opts[1:]...), ","), nil
+}
+
+// EnvVar will return the name of the env var used to configure the
+// Target's variant (GOARM, GOAMD64, etc.), if any.
+func (t Target) EnvVar() string {
+	if v, ok := variants[t.Arch]; ok {
+		return v.env
+	}
+
+	return ""
+}
+
+// Output will return an output filename for the Target, derived from
+// the provided name (e.g. "app_linux_arm_7" or
+// "app_windows_amd64.exe").
+func (t Target) Output(name string) string {
+	var out []string = []string{
+		strings.TrimSuffix(name, ".exe"),
+		t.OS,
+		t.Arch,
+	}
+
+	if t.Variant != "" {
+		out = append(out, strings.ReplaceAll(t.Variant, ",", "_"))
+	}
+
+	if t.OS == "windows" {
+		return strings.Join(out, "_") + ".exe"
+	}
+
+	return strings.Join(out, "_")
+}
+
+// String will return the Target in "os/arch[/variant]" form.
+func (t Target) String() string {
+	if t.Variant == "" {
+		return t.OS + "/" + t.Arch
+	}
+
+	return t.OS + "/" + t.Arch + "/" + t.Variant
+}
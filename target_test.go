@@ -0,0 +1,132 @@
+//nolint:godoclint // These are tests
+package xgo_test
+
+import (
+	"testing"
+
+	"github.com/mjwhitta/xgo"
+	assert "github.com/stretchr/testify/require"
+)
+
+type targetTest struct {
+	spec   string
+	target xgo.Target
+	output string
+	pass   bool
+}
+
+func TestParseTarget(t *testing.T) {
+	t.Parallel()
+
+	var tests []targetTest = []targetTest{
+		{
+			"linux/amd64",
+			xgo.Target{OS: "linux", Arch: "amd64"},
+			"app_linux_amd64",
+			true,
+		},
+		{
+			"linux/amd64/v3",
+			xgo.Target{OS: "linux", Arch: "amd64", Variant: "v3"},
+			"app_linux_amd64_v3",
+			true,
+		},
+		{
+			"linux/amd64/3",
+			xgo.Target{OS: "linux", Arch: "amd64", Variant: "v3"},
+			"app_linux_amd64_v3",
+			true,
+		},
+		{
+			"linux/arm/7",
+			xgo.Target{OS: "linux", Arch: "arm", Variant: "7"},
+			"app_linux_arm_7",
+			true,
+		},
+		{
+			"linux/arm/v6",
+			xgo.Target{OS: "linux", Arch: "arm", Variant: "6"},
+			"app_linux_arm_6",
+			true,
+		},
+		{
+			"linux/arm/7,softfloat",
+			xgo.Target{
+				OS:      "linux",
+				Arch:    "arm",
+				Variant: "7,softfloat",
+			},
+			"app_linux_arm_7_softfloat",
+			true,
+		},
+		{
+			"linux/mips/softfloat",
+			xgo.Target{
+				OS:      "linux",
+				Arch:    "mips",
+				Variant: "softfloat",
+			},
+			"app_linux_mips_softfloat",
+			true,
+		},
+		{
+			"windows/386/sse2",
+			xgo.Target{OS: "windows", Arch: "386", Variant: "sse2"},
+			"app_windows_386_sse2.exe",
+			true,
+		},
+		{"linux", xgo.Target{}, "", false},
+		{"linux/", xgo.Target{}, "", false},
+		{"linux/arm/8", xgo.Target{}, "", false},
+		{"linux/arm/7,fast", xgo.Target{}, "", false},
+		{"linux/amd64/v5", xgo.Target{}, "", false},
+		{"linux/s390x/z15", xgo.Target{}, "", false},
+		{"linux/amd64/v3/extra", xgo.Target{}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.spec,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var e error
+				var target xgo.Target
+
+				target, e = xgo.ParseTarget(test.spec)
+				if !test.pass {
+					assert.Error(t, e)
+					return
+				}
+
+				assert.NoError(t, e)
+				assert.Equal(t, test.target, target)
+				assert.Equal(t, test.output, target.Output("app.exe"))
+
+				target, e = xgo.ParseTarget(target.String())
+				assert.NoError(t, e)
+				assert.Equal(t, test.target, target)
+			},
+		)
+	}
+}
+
+func TestSetupTargetEnv(t *testing.T) {
+	t.Parallel()
+
+	var e error
+	var env map[string]string
+	var target xgo.Target = xgo.Target{
+		OS:      "linux",
+		Arch:    "arm",
+		Variant: "6",
+	}
+	var x *xgo.Compiler = &xgo.Compiler{}
+
+	env, e = x.SetupTargetEnv(target)
+	assert.NoError(t, e)
+	assert.Equal(t, "arm", env["GOARCH"])
+	assert.Equal(t, "6", env["GOARM"])
+	assert.Equal(t, "linux", env["GOOS"])
+	assert.Equal(t, target, xgo.TargetFromEnv(env))
+}
@@ -0,0 +1,6 @@
+package xgo
+
+// tiocspgrp is the ioctl to set the terminal's foreground process
+// group. unix.TIOCSPGRP is sign-extended on aix, which overflows the
+// int that the ioctl takes, so use the 32-bit value.
+const tiocspgrp = -0x7ffb8b8a // int32(0x80047476)
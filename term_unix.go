@@ -0,0 +1,9 @@
+//go:build unix && !aix
+
+package xgo
+
+import "golang.org/x/sys/unix"
+
+// tiocspgrp is the ioctl to set the terminal's foreground process
+// group.
+const tiocspgrp = unix.TIOCSPGRP
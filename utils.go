@@ -1,74 +1,107 @@
 package xgo
 
 import (
+	"os"
 	"runtime"
 	"strings"
 )
 
-func quote(env string) string {
-	if before, after, ok := strings.Cut(env, "="); ok {
-		// Shouldn't have spaces before equal, must be a value
-		if strings.Contains(before, " ") {
-			return "\"" + strings.ReplaceAll(env, "\"", "\\\"") + "\""
-		}
+func archiveMode(mode os.FileMode) os.FileMode {
+	// Normalize to either executable or not
+	if mode.Perm()&0o111 != 0 {
+		return 0o755 //nolint:mnd // u=rwx,go=rx
+	}
 
-		// No need to wrap booleans
-		switch after {
-		case "false", "true":
-			return env
-		}
+	return 0o644 //nolint:mnd // u=rw,go=r
+}
+
+// Return true if the host C compiler can also build for the Target
+// (e.g. gcc -m32 for 386 on amd64, or clang -arch on darwin)
+func hostCC(t Target) bool {
+	switch {
+	case t.OS != runtime.GOOS:
+		return false
+	case (t.Arch == runtime.GOARCH) || (t.OS == "darwin"):
+		return true
+	}
+
+	return (runtime.GOARCH == "amd64") && (t.Arch == "386")
+}
 
-		env = before + "=\"" + after + "\""
+func isDir(fn string) bool {
+	if fi, e := os.Stat(fn); (e == nil) && fi.IsDir() {
+		return true
+	}
+
+	return false
+}
+
+func osEnv() map[string]string {
+	var env map[string]string = map[string]string{}
+
+	for _, line := range os.Environ() {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			v = strings.TrimPrefix(v, "'")
+			v = strings.TrimSuffix(v, "'")
+			env[k] = v
+		}
 	}
 
 	return env
 }
 
-func setupCC(goos string, goarch string) (string, string) {
-	var cc string
-	var cxx string
+func setupCC(t Target) (string, string) {
+	var targets map[string][]string
 
-	if (goarch == runtime.GOARCH) && (goos == runtime.GOOS) {
+	if (t.Arch == runtime.GOARCH) && (t.OS == runtime.GOOS) {
 		return "", ""
 	}
 
 	if _, ok := crossCC[runtime.GOOS]; !ok {
 		return "", ""
-	} else if _, ok := crossCC[runtime.GOOS][goos]; !ok {
-		return "", ""
-	} else if _, ok := crossCC[runtime.GOOS][goos][goarch]; !ok {
+	} else if _, ok := crossCC[runtime.GOOS][t.OS]; !ok {
 		return "", ""
 	}
 
-	cc = crossCC[runtime.GOOS][goos][goarch][0]
-	cxx = crossCC[runtime.GOOS][goos][goarch][1]
+	targets = crossCC[runtime.GOOS][t.OS]
 
-	return cc, cxx
+	for _, key := range variantKeys(t) {
+		if cccxx, ok := targets[key]; ok {
+			return cccxx[0], cccxx[1]
+		}
+	}
+
+	return "", ""
 }
 
-func setupZig(goos string, goarch string) (string, string) {
+func setupZig(t Target) (string, string) {
 	var cc string = "zig cc --target="
 	var cxx string = "zig c++ --target="
 	var translate map[string]string = map[string]string{
 		"386":     "x86",
 		"amd64":   "x86_64",
+		"arm":     "arm",
 		"arm64":   "aarch64",
 		"darwin":  "macos",
 		"linux":   "linux",
 		"windows": "windows",
 	}
 
-	if (goarch == runtime.GOARCH) && (goos == runtime.GOOS) {
+	if (t.Arch == runtime.GOARCH) && (t.OS == runtime.GOOS) {
 		return "", ""
 	}
 
-	if (goarch == "arm64") && (goos != "darwin") {
+	if (t.Arch == "arm64") && (t.OS != "darwin") {
 		return "", ""
 	}
 
-	if _, ok := translate[goarch]; ok {
-		cc += translate[goarch]
-		cxx += translate[goarch]
+	if (t.Arch == "arm") && (t.OS != "linux") {
+		return "", ""
+	}
+
+	if _, ok := translate[t.Arch]; ok {
+		cc += translate[t.Arch]
+		cxx += translate[t.Arch]
 	} else {
 		return "", ""
 	}
@@ -76,12 +109,50 @@ func setupZig(goos string, goarch string) (string, string) {
 	cc += "-"
 	cxx += "-"
 
-	if _, ok := translate[goos]; ok {
-		cc += translate[goos]
-		cxx += translate[goos]
+	if _, ok := translate[t.OS]; ok {
+		cc += translate[t.OS]
+		cxx += translate[t.OS]
 	} else {
 		return "", ""
 	}
 
+	// Match the float ABI used by crossCC (gnueabi vs gnueabihf)
+	if t.Arch == "arm" {
+		cc += "-" + zigARMABI(t)
+		cxx += "-" + zigARMABI(t)
+	}
+
 	return cc, cxx
 }
+
+// Return the zig ABI for an ARM Target: soft-float for GOARM=5 or
+// softfloat, otherwise hard-float.
+func zigARMABI(t Target) string {
+	for _, key := range variantKeys(t) {
+		switch key {
+		case "arm/5", "arm/softfloat":
+			return "musleabi"
+		}
+	}
+
+	return "musleabihf"
+}
+
+// Return the keys for the Target, from most to least specific: the
+// variant, then each of its options (e.g. "arm/7,softfloat", "arm/7",
+// "arm/softfloat"), and finally GOARCH alone.
+func variantKeys(t Target) []string {
+	var keys []string
+
+	if t.Variant == "" {
+		return []string{t.Arch}
+	}
+
+	keys = []string{t.Arch + "/" + t.Variant}
+
+	for opt := range strings.SplitSeq(t.Variant, ",") {
+		keys = append(keys, t.Arch+"/"+opt)
+	}
+
+	return append(keys, t.Arch)
+}
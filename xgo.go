@@ -1,21 +1,32 @@
 package xgo
 
 import (
+	"maps"
+	"os"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strings"
 )
 
-// BuildArgsSanityCheck will ensure the build args include some sane
-// defaults. It will not alter existing args.
-func BuildArgsSanityCheck(args []string) []string {
+// BuildArgsSanityCheck will ensure the build args include the
+// default flags from the provided Profile, unless they were already
+// provided, either as args (with one or two dashes) or in the GOFLAGS
+// env var. If merge is true, any missing default values for list
+// flags (-gcflags, -ldflags, and -tags) are merged into the values
+// provided (e.g. -s -w is added to -ldflags=-X=main.v=1). Otherwise,
+// it will not alter existing args.
+func BuildArgsSanityCheck(
+	args []string,
+	p Profile,
+	merge bool,
+) []string {
+	var a GoArgs
 	var add []string
-	var found bool
-	var opts [][]string = [][]string{
-		{"--buildvcs", "false"},
-		{"--ldflags", "-s -w"},
-		{"--trimpath", ""},
-	}
+	var i int
+	var pos []int
+	var tmp []string
+	var v string
 
 	if len(args) == 0 {
 		return nil
@@ -28,24 +39,35 @@ func BuildArgsSanityCheck(args []string) []string {
 		return args
 	}
 
-	add = []string{args[0]}
-
-	for _, o := range opts {
-		found = false
-		for _, arg := range args {
-			if found = strings.HasPrefix(arg, o[0]); found {
-				break
+	a, pos = parseGoArgs(args, os.Getenv("GOFLAGS"))
+	tmp = slices.Clone(args)
+
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		switch i = a.index(name); {
+		case i < 0:
+			add = append(add, profileFlag(name, p[name]))
+		case !merge || !slices.Contains(listFlags, name):
+		default:
+			// Defaults for other packages (e.g. all=) need their own
+			// flag, first, as go uses the last flag that matches
+			if differentPattern(a.Flags[i].Value, p[name]) {
+				add = append(add, profileFlag(name, p[name]))
 			}
-		}
 
-		if found {
-			continue
-		}
+			v = mergeFlag(name, a.Flags[i].Value, p[name])
 
-		add = append(add, strings.TrimSuffix(o[0]+"="+o[1], "="))
+			// Flags from GOFLAGS are overridden, rather than changed
+			switch {
+			case v == a.Flags[i].Value:
+			case pos[i] < 0:
+				add = append(add, profileFlag(name, v))
+			default:
+				setFlag(tmp, pos[i], v)
+			}
+		}
 	}
 
-	return append(add, args[1:]...)
+	return slices.Concat(tmp[:1], add, tmp[1:])
 }
 
 // MissingToolchains returns a list of toolchains that are not
@@ -81,3 +103,24 @@ func MissingToolchains() map[string][]string {
 
 	return missing
 }
+
+// Return whether the wanted value for a list flag has a package
+// pattern, other than the one provided
+func differentPattern(have string, want string) bool {
+	var havePattern string
+	var wantPattern string
+
+	havePattern, _ = splitPattern(have)
+	wantPattern, _ = splitPattern(want)
+
+	return (wantPattern != "") && (wantPattern != havePattern)
+}
+
+func profileFlag(name string, value string) string {
+	// Boolean flags don't need a value
+	if (value == "") && !slices.Contains(valueFlags, name) {
+		return "--" + name
+	}
+
+	return "--" + name + "=" + value
+}
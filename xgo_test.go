@@ -14,6 +14,19 @@ type buildArgsTest struct {
 	out  []string
 }
 
+func release(t *testing.T) xgo.Profile {
+	t.Helper()
+
+	var c *xgo.Config = &xgo.Config{}
+	var e error
+	var p xgo.Profile
+
+	p, e = c.Profile("release")
+	assert.NoError(t, e)
+
+	return p
+}
+
 func TestBuildArgsSanityCheck(t *testing.T) {
 	t.Parallel()
 
@@ -48,6 +61,34 @@ func TestBuildArgsSanityCheck(t *testing.T) {
 			[]string{"build", "--buildvcs=a", "--ldflags=-s", btrim},
 			[]string{"build", "--buildvcs=a", "--ldflags=-s", btrim},
 		},
+		{
+			"Single dash",
+			[]string{"build", "-buildvcs", "-ldflags", "-s", "-n"},
+			[]string{
+				"build", btrim, "-buildvcs", "-ldflags", "-s", "-n",
+			},
+		},
+		{
+			"Flag values",
+			[]string{"build", "-o", "--trimpath", "."},
+			[]string{
+				"build", bvcs, bld, btrim, "-o", "--trimpath", ".",
+			},
+		},
+		{
+			"Packages",
+			[]string{"install", ".", "--trimpath", "--", "-ldflags"},
+			[]string{
+				"install",
+				bvcs,
+				bld,
+				btrim,
+				".",
+				"--trimpath",
+				"--",
+				"-ldflags",
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -56,7 +97,11 @@ func TestBuildArgsSanityCheck(t *testing.T) {
 			func(t *testing.T) {
 				t.Parallel()
 
-				var args []string = xgo.BuildArgsSanityCheck(test.in)
+				var args []string = xgo.BuildArgsSanityCheck(
+					test.in,
+					release(t),
+					false,
+				)
 
 				assert.Equal(t, test.out, args)
 			},
@@ -64,6 +109,142 @@ func TestBuildArgsSanityCheck(t *testing.T) {
 	}
 }
 
+func TestBuildArgsSanityCheckMerge(t *testing.T) {
+	t.Parallel()
+
+	var bvcs string = "--buildvcs=false"
+	var btrim string = "--trimpath"
+	var tests []buildArgsTest = []buildArgsTest{
+		{
+			"Missing",
+			[]string{"build", bvcs, btrim, "-ldflags=-X main.v=1"},
+			[]string{
+				"build",
+				bvcs,
+				btrim,
+				"-ldflags=-X main.v=1 -s -w",
+			},
+		},
+		{
+			"Space-separated",
+			[]string{"build", bvcs, btrim, "-ldflags", "-w"},
+			[]string{"build", bvcs, btrim, "-ldflags", "-w -s"},
+		},
+		{
+			"Existing",
+			[]string{"build", bvcs, btrim, "-ldflags=-s=0 -w=0"},
+			[]string{"build", bvcs, btrim, "-ldflags=-s=0 -w=0"},
+		},
+		{
+			"Quoted",
+			[]string{"build", bvcs, btrim, "-ldflags=-X 'a=-s' -w"},
+			[]string{
+				"build",
+				bvcs,
+				btrim,
+				"-ldflags=-X 'a=-s' -w -s",
+			},
+		},
+		{
+			"Pattern",
+			[]string{"build", bvcs, btrim, "-ldflags=all=-s"},
+			[]string{"build", bvcs, btrim, "-ldflags=all=-s -w"},
+		},
+		{
+			"Last wins",
+			[]string{
+				"build",
+				bvcs,
+				btrim,
+				"-ldflags=-s",
+				"-ldflags=-w",
+			},
+			[]string{
+				"build",
+				bvcs,
+				btrim,
+				"-ldflags=-s",
+				"-ldflags=-w -s",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				t.Parallel()
+
+				var args []string = xgo.BuildArgsSanityCheck(
+					test.in,
+					release(t),
+					true,
+				)
+
+				assert.Equal(t, test.out, args)
+			},
+		)
+	}
+}
+
+func TestBuildArgsSanityCheckProfile(t *testing.T) {
+	t.Parallel()
+
+	var c *xgo.Config = &xgo.Config{}
+	var e error
+	var p xgo.Profile
+
+	p, e = c.Profile("debug")
+	assert.NoError(t, e)
+	assert.Equal(
+		t,
+		[]string{
+			"build",
+			"--buildvcs=false",
+			"--gcflags=all=-N -l",
+			"-gcflags=-m -N -l",
+			".",
+		},
+		xgo.BuildArgsSanityCheck(
+			[]string{"build", "-gcflags=-m", "."},
+			p,
+			true,
+		),
+	)
+
+	// The same pattern only needs one flag
+	assert.Equal(
+		t,
+		[]string{
+			"build", "--buildvcs=false", "-gcflags=all=-m -N -l", ".",
+		},
+		xgo.BuildArgsSanityCheck(
+			[]string{"build", "-gcflags=all=-m", "."},
+			p,
+			true,
+		),
+	)
+
+	p, e = c.Profile("minimal")
+	assert.NoError(t, e)
+	assert.Equal(
+		t,
+		[]string{"build", "."},
+		xgo.BuildArgsSanityCheck([]string{"build", "."}, p, true),
+	)
+
+	// Value flags always get a value, even if empty
+	assert.Equal(
+		t,
+		[]string{"build", "--ldflags=", "--trimpath", "."},
+		xgo.BuildArgsSanityCheck(
+			[]string{"build", "."},
+			xgo.Profile{"ldflags": "", "trimpath": ""},
+			true,
+		),
+	)
+}
+
 func TestMissingToolchains(t *testing.T) {
 	t.Parallel()
 